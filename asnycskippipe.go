@@ -12,8 +12,11 @@ type AsyncSkipPipe[T any] struct {
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -45,34 +48,76 @@ func (b *AsyncSkipPipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b AsyncSkipPipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *AsyncSkipPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *AsyncSkipPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *AsyncSkipPipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *AsyncSkipPipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel if it is available
 // exit when our context is closed
 func (b *AsyncSkipPipe[_]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 	defer close(b.outchan)
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-b.inchan:
 			if !ok {
 				return
 			}
+			b.metrics.in()
 			select {
 			case b.outchan <- t:
+				b.metrics.out()
 			case <-b.ctx.Done():
 				return
 			default:
+				b.metrics.dropped(1)
 			}
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (AsyncSkipPipe[T]) NewWithChannel(in chan T) *AsyncSkipPipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (b AsyncSkipPipe[T]) NewWithChannel(in chan T) *AsyncSkipPipe[T] {
+	return b.NewWithContext(context.Background(), in)
+}
+
+func (AsyncSkipPipe[T]) NewWithContext(ctx context.Context, in chan T) *AsyncSkipPipe[T] {
+	con, cancel := context.WithCancel(ctx)
 	r := AsyncSkipPipe[T]{
 		ctx: con, can: cancel, wg: new(sync.WaitGroup),
+		done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics),
 		inchan: in, outchan: make(chan T, CHANSIZE)}
 
 	r.wg.Add(1)
@@ -82,7 +127,11 @@ func (AsyncSkipPipe[T]) NewWithChannel(in chan T) *AsyncSkipPipe[T] {
 }
 
 func (b AsyncSkipPipe[T]) NewWithPipeline(p Pipeline[T]) *AsyncSkipPipe[T] {
-	r := b.NewWithChannel(p.PipelineChan())
+	return b.NewWithPipelineContext(context.Background(), p)
+}
+
+func (b AsyncSkipPipe[T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T]) *AsyncSkipPipe[T] {
+	r := b.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -0,0 +1,230 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BatchPipe groups items into slices.  A batch is sent when it has maxCount items,
+// when the Size() of the items (if they are Sizers) reaches maxBytes, or when
+// flushTime has passed since the first item of the batch arrived.
+// A limit of 0 is not used.
+type BatchPipe[T any] struct {
+	maxCount  int
+	maxBytes  int
+	flushTime time.Duration
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan []T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+
+	// Clock is used for the flush time, nil is RealClock
+	Clock Clock
+}
+
+// InChan
+func (b BatchPipe[T]) InChan() chan<- T {
+	return b.inchan
+}
+
+// OutChan
+func (b BatchPipe[T]) OutChan() <-chan []T {
+	return b.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (b BatchPipe[T]) PipelineChan() chan []T {
+	return b.outchan
+}
+
+// Close
+func (b *BatchPipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if b.pl != nil {
+		b.pl.Close()
+	}
+
+	// Cancel our context
+	b.can()
+
+	// Wait for us to be done
+	b.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (b BatchPipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *BatchPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *BatchPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *BatchPipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *BatchPipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
+// itemSize returns the Size of t if it is a Sizer, 0 if not
+func itemSize[T any](t T) int {
+	var i any = t
+	if s, ok := i.(Sizer); ok {
+		return s.Size()
+	}
+	return 0
+}
+
+// mainloop, read from in channel and add to the batch, write the batch to the out channel
+// when it is full or the flush timer goes off.  On input close we send what we have,
+// exit when our context is closed
+func (b *BatchPipe[T]) mainloop() {
+	defer close(b.done)
+	defer b.wg.Done()
+	defer close(b.outchan)
+
+	var batch []T
+	var started time.Time
+	size := 0
+
+	var timer Timer
+	var timeout <-chan time.Time
+
+	// flush sends the batch and resets, returns false if our context is closed
+	flush := func() bool {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return true
+		}
+
+		out := batch
+		batch, size = nil, 0
+
+		b.metrics.sending()
+		select {
+		case b.outchan <- out:
+			b.metrics.out()
+			b.metrics.depth(0)
+			b.metrics.latency(started)
+			return true
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+
+	stop := b.drain.ch
+	for {
+		// When draining, send what we have once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			flush()
+			return
+		}
+
+		select {
+		case t, ok := <-b.inchan:
+			if !ok {
+				flush()
+				return
+			}
+			b.metrics.in()
+			if len(batch) == 0 {
+				started = b.metrics.start()
+				if b.flushTime > 0 {
+					timer = b.Clock.NewTimer(b.flushTime)
+					timeout = timer.C()
+				}
+			}
+			batch = append(batch, t)
+			size += itemSize(t)
+			b.metrics.depth(len(batch))
+
+			if (b.maxCount > 0 && len(batch) >= b.maxCount) || (b.maxBytes > 0 && size >= b.maxBytes) {
+				if !flush() {
+					return
+				}
+			}
+			b.metrics.receiving()
+		case <-timeout:
+			if !flush() {
+				return
+			}
+		case <-stop:
+			stop = nil
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b BatchPipe[T]) NewWithChannel(maxCount int, maxBytes int, flushTime time.Duration, in chan T) (*BatchPipe[T], error) {
+	return b.NewWithContext(context.Background(), maxCount, maxBytes, flushTime, in)
+}
+
+func (b BatchPipe[T]) NewWithContext(ctx context.Context, maxCount int, maxBytes int, flushTime time.Duration, in chan T) (*BatchPipe[T], error) {
+	if maxCount < 1 && maxBytes < 1 && flushTime <= 0 {
+		return nil, errors.New("batch needs a count, byte or time limit")
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := BatchPipe[T]{
+		maxCount:  maxCount,
+		maxBytes:  maxBytes,
+		flushTime: flushTime,
+		ctx:       con,
+		can:       cancel,
+		wg:        new(sync.WaitGroup),
+		done:      make(chan struct{}),
+		drain:     newSignal(),
+		metrics:   newStageMetrics(b.Clock),
+		inchan:    in,
+		outchan:   make(chan []T, CHANSIZE),
+		Clock:     orRealClock(b.Clock)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (b BatchPipe[T]) NewWithPipeline(maxCount int, maxBytes int, flushTime time.Duration, p Pipeline[T]) (*BatchPipe[T], error) {
+	return b.NewWithPipelineContext(context.Background(), maxCount, maxBytes, flushTime, p)
+}
+
+func (b BatchPipe[T]) NewWithPipelineContext(ctx context.Context, maxCount int, maxBytes int, flushTime time.Duration, p Pipeline[T]) (*BatchPipe[T], error) {
+	r, err := b.NewWithContext(ctx, maxCount, maxBytes, flushTime, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (b BatchPipe[T]) New(maxCount int, maxBytes int, flushTime time.Duration) (*BatchPipe[T], error) {
+	return b.NewWithChannel(maxCount, maxBytes, flushTime, make(chan T, CHANSIZE))
+}
@@ -0,0 +1,79 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleBatchPipe_New() {
+	b, _ := pipelines.BatchPipe[int]{}.New(3, 0, 0)
+
+	go func() {
+		for i := 0; i < 7; i++ {
+			b.InChan() <- i
+		}
+		close(b.InChan())
+	}()
+
+	// The last batch is sent when the input is closed
+	for batch := range b.OutChan() {
+		fmt.Println(batch)
+	}
+
+	b.Close()
+	// Output:
+	// [0 1 2]
+	// [3 4 5]
+	// [6]
+}
+
+func ExampleBatchPipe_bytes() {
+	b, _ := pipelines.BatchPipe[pipelines.Packet]{}.New(0, 10, 0)
+
+	go func() {
+		b.InChan() <- pipelines.Packet{DataSlice: []byte("hello")}
+		b.InChan() <- pipelines.Packet{DataSlice: []byte("world")}
+		b.InChan() <- pipelines.Packet{DataSlice: []byte("!")}
+	}()
+
+	fmt.Println(len(<-b.OutChan()))
+
+	b.Close()
+	// Output:
+	// 2
+}
+
+func ExampleBatchPipe_flushtime() {
+	b, _ := pipelines.BatchPipe[int]{}.New(100, 0, 10*time.Millisecond)
+
+	b.InChan() <- 1
+	b.InChan() <- 2
+
+	fmt.Println(<-b.OutChan())
+
+	b.Close()
+	// Output:
+	// [1 2]
+}
+
+func ExampleUnbatchPipe_NewWithPipeline() {
+	b, _ := pipelines.BatchPipe[int]{}.New(2, 0, 0)
+	u := pipelines.UnbatchPipe[int]{}.NewWithPipeline(b)
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			b.InChan() <- i
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		fmt.Print(<-u.OutChan(), " ")
+	}
+	fmt.Println()
+
+	u.Close()
+	// Output:
+	// 0 1 2 3
+}
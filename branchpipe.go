@@ -0,0 +1,127 @@
+package pipelines
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// branchOwner is a pipe that has more than one output, it is told when a branch is closed or drained
+type branchOwner[T any] interface {
+	closeBranch(b *BranchPipe[T])
+	drainBranch(ctx context.Context, b *BranchPipe[T]) error
+}
+
+// BranchPipe is one output of a pipe that has many outputs, like TeePipe or RouterPipe.
+// Closing a branch only detaches it from its owner, the owner is closed once
+// all of its branches are closed.
+type BranchPipe[T any] struct {
+	ctx context.Context
+	can context.CancelFunc
+
+	outchan chan T
+
+	dropped uint64
+
+	owner   branchOwner[T]
+	once    *sync.Once
+	metrics *stageMetrics
+}
+
+// OutChan
+func (b BranchPipe[T]) OutChan() <-chan T {
+	return b.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (b BranchPipe[T]) PipelineChan() chan T {
+	return b.outchan
+}
+
+// Dropped returns the number of items this branch has skipped
+func (b *BranchPipe[_]) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// Close detaches the branch from its owner, it is safe to call more than once
+func (b *BranchPipe[_]) Close() {
+	b.once.Do(func() {
+		b.can()
+		b.owner.closeBranch(b)
+	})
+}
+
+// Drain detaches the branch once the owner has finished, see Drainer.
+// The owner is drained when the last of its branches is drained.
+func (b *BranchPipe[_]) Drain(ctx context.Context) error {
+	var err error
+	b.once.Do(func() {
+		err = b.owner.drainBranch(ctx, b)
+	})
+
+	return err
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *BranchPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats.  Held is the number
+// of items in our output buffer
+func (b *BranchPipe[_]) Stats() Stats {
+	st := b.metrics.stats(nil, 0)
+	st.Held = len(b.outchan)
+	if b.closed() {
+		st.State = STATESTOPPED
+	}
+	return st
+}
+
+// Upstreams returns the pipe we are a branch of
+func (b *BranchPipe[_]) Upstreams() []any {
+	return []any{b.owner}
+}
+
+// closed returns true once the branch has been detached or the owner is done
+func (b *BranchPipe[_]) closed() bool {
+	return b.ctx.Err() != nil
+}
+
+// send writes t to the branch, when block is false the item is dropped if the
+// output channel is not ready.  returns false if the item was dropped
+func (b *BranchPipe[T]) send(t T, block bool) bool {
+	if b.closed() {
+		atomic.AddUint64(&b.dropped, 1)
+		b.metrics.dropped(1)
+		return false
+	}
+
+	if block {
+		b.metrics.sending()
+		select {
+		case b.outchan <- t:
+			b.metrics.out()
+			return true
+		case <-b.ctx.Done():
+		}
+	} else {
+		select {
+		case b.outchan <- t:
+			b.metrics.out()
+			return true
+		default:
+		}
+	}
+
+	atomic.AddUint64(&b.dropped, 1)
+	b.metrics.dropped(1)
+	return false
+}
+
+// newBranch creates a branch whose context is a child of the owners
+func newBranch[T any](ctx context.Context, owner branchOwner[T], size int) *BranchPipe[T] {
+	con, cancel := context.WithCancel(ctx)
+	return &BranchPipe[T]{ctx: con, can: cancel, owner: owner, once: new(sync.Once),
+		metrics: new(stageMetrics), outchan: make(chan T, size)}
+}
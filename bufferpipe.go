@@ -3,18 +3,69 @@ package pipelines
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// OverflowPolicy is what a BufferPipe does with an item that comes in when it is full
+type OverflowPolicy int
+
+const (
+	// OVERFLOWBLOCK waits for room, this is the default
+	OVERFLOWBLOCK = OverflowPolicy(0)
+	// OVERFLOWDROPNEWEST throws away the item that does not fit
+	OVERFLOWDROPNEWEST = OverflowPolicy(1)
+	// OVERFLOWDROPOLDEST throws away the oldest item we hold to make room, like a ring buffer
+	OVERFLOWDROPOLDEST = OverflowPolicy(2)
+	// OVERFLOWTIMEOUT waits up to Timeout for room, then throws away the item that does not fit
+	OVERFLOWTIMEOUT = OverflowPolicy(3)
+)
+
+var overflowNames = []string{"block", "dropnewest", "dropoldest", "timeout"}
+
+func (o OverflowPolicy) String() string {
+	if o >= 0 && int(o) < len(overflowNames) {
+		return overflowNames[o]
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(o))
+}
+
+// ParseOverflowPolicy returns the policy named by its String
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for i, n := range overflowNames {
+		if n == s {
+			return OverflowPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", s)
+}
+
+// BufferPipe holds up to size items between its input and output.  Set Policy to choose
+// what happens when it is full, for example BufferPipe[T]{Policy: OVERFLOWDROPOLDEST}.New(10)
+// keeps the newest 10 items for a slow reader.
 type BufferPipe[T any] struct {
+	// Policy is used when we are full, Timeout is how long OVERFLOWTIMEOUT waits
+	Policy  OverflowPolicy
+	Timeout time.Duration
+
+	// Clock is used for Timeout, nil is RealClock
+	Clock Clock
+
+	size int
+
 	ctx context.Context
 	can context.CancelFunc
 
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // InChan
@@ -46,48 +97,222 @@ func (b *BufferPipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b BufferPipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *BufferPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// Dropped returns the number of items we have thrown away because we were full
+func (b *BufferPipe[_]) Dropped() uint64 {
+	return atomic.LoadUint64(&b.metrics.ndropped)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *BufferPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *BufferPipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *BufferPipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely
 // exit when our context is closed
 func (b *BufferPipe[_]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 	defer close(b.outchan)
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
-		case t := <-b.inchan:
+		case t, ok := <-b.inchan:
+			if !ok {
+				return
+			}
+			b.metrics.in()
+			b.metrics.depth(len(b.inchan))
+			b.metrics.sending()
 			select {
 			case b.outchan <- t:
+				b.metrics.out()
 			case <-b.ctx.Done():
 				return
 			}
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (BufferPipe[T]) NewWithChannel(size int, in chan T) (*BufferPipe[T], error) {
+// queueloop is the mainloop when we drop items.  We hold the items ourselves so we can
+// always read the input and choose what to throw away when we are full.  On input close
+// we send what we hold, exit when our context is closed
+func (b *BufferPipe[T]) queueloop() {
+	defer close(b.done)
+	defer b.wg.Done()
+	defer close(b.outchan)
+
+	queue := make([]T, 0, b.size)
+	in := b.inchan
+	stop := b.drain.ch
+	for {
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && len(queue) == 0 {
+			return
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if len(queue) > 0 {
+			out, head = b.outchan, queue[0]
+			b.metrics.sending()
+		} else {
+			b.metrics.receiving()
+		}
+
+		select {
+		case out <- head:
+			queue = popFront(queue)
+			b.metrics.out()
+			b.metrics.depth(len(queue))
+		case t, ok := <-in:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			b.metrics.in()
+			if queue, ok = b.add(queue, t); !ok {
+				return
+			}
+			b.metrics.depth(len(queue))
+		case <-stop:
+			stop = nil
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// add puts t on the queue following our policy when it is full, returns false if our context is closed
+func (b *BufferPipe[T]) add(queue []T, t T) ([]T, bool) {
+	if len(queue) < b.size {
+		return append(queue, t), true
+	}
+
+	switch b.Policy {
+	case OVERFLOWDROPOLDEST:
+		b.metrics.dropped(1)
+		return append(popFront(queue), t), true
+	case OVERFLOWTIMEOUT:
+		// Make room by sending the head
+		timer := b.Clock.NewTimer(b.Timeout)
+		defer timer.Stop()
+
+		b.metrics.sending()
+		select {
+		case b.outchan <- queue[0]:
+			b.metrics.out()
+			return append(popFront(queue), t), true
+		case <-timer.C():
+		case <-b.ctx.Done():
+			return queue, false
+		}
+	}
+
+	b.metrics.dropped(1)
+	return queue, true
+}
+
+// popFront removes the head of the queue, clearing it so we don't hold a reference
+func popFront[T any](queue []T) []T {
+	var zero T
+	queue[0] = zero
+	return queue[1:]
+}
+
+// start checks our settings and runs the loop for our policy
+func (b *BufferPipe[T]) start() error {
+	if b.Policy < OVERFLOWBLOCK || b.Policy > OVERFLOWTIMEOUT {
+		b.can()
+		return fmt.Errorf("unknown overflow policy %v", b.Policy)
+	}
+	b.Clock = orRealClock(b.Clock)
+
+	b.wg.Add(1)
+	if b.Policy == OVERFLOWBLOCK {
+		go b.mainloop()
+	} else {
+		go b.queueloop()
+	}
+	return nil
+}
+
+// chanSize is the size for the channel that holds our items, when we drop items we hold them
+func (b BufferPipe[T]) chanSize(size int) int {
+	if b.Policy == OVERFLOWBLOCK {
+		return size
+	}
+	return CHANSIZE
+}
+
+func (b BufferPipe[T]) NewWithChannel(size int, in chan T) (*BufferPipe[T], error) {
+	return b.NewWithContext(context.Background(), size, in)
+}
+
+func (b BufferPipe[T]) NewWithContext(ctx context.Context, size int, in chan T) (*BufferPipe[T], error) {
 	if size < 1 {
 		return nil, errors.New("buffer size must be >= 1")
 	}
 
-	con, cancel := context.WithCancel(context.Background())
+	con, cancel := context.WithCancel(ctx)
 
 	r := BufferPipe[T]{
+		Policy:  b.Policy,
+		Timeout: b.Timeout,
+		Clock:   b.Clock,
+		size:    size,
 		ctx:     con,
 		can:     cancel,
 		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: newStageMetrics(b.Clock),
 		inchan:  in,
-		outchan: make(chan T, size)}
+		outchan: make(chan T, b.chanSize(size))}
 
-	r.wg.Add(1)
-	go r.mainloop()
+	if err := r.start(); err != nil {
+		return nil, err
+	}
 
 	return &r, nil
 }
 
 func (b BufferPipe[T]) NewWithPipeline(size int, p Pipeline[T]) (*BufferPipe[T], error) {
-	r, err := b.NewWithChannel(size, p.PipelineChan())
+	return b.NewWithPipelineContext(context.Background(), size, p)
+}
+
+func (b BufferPipe[T]) NewWithPipelineContext(ctx context.Context, size int, p Pipeline[T]) (*BufferPipe[T], error) {
+	r, err := b.NewWithContext(ctx, size, p.PipelineChan())
 	if err != nil {
 		return nil, err
 	}
@@ -97,21 +322,29 @@ func (b BufferPipe[T]) NewWithPipeline(size int, p Pipeline[T]) (*BufferPipe[T],
 	return r, nil
 }
 
-func (BufferPipe[T]) New(size int) (*BufferPipe[T], error) {
+func (b BufferPipe[T]) New(size int) (*BufferPipe[T], error) {
 	if size < 1 {
 		return nil, errors.New("buffer size must be >= 1")
 	}
 
 	con, cancel := context.WithCancel(context.Background())
 	r := BufferPipe[T]{
+		Policy:  b.Policy,
+		Timeout: b.Timeout,
+		Clock:   b.Clock,
+		size:    size,
 		ctx:     con,
 		can:     cancel,
 		wg:      new(sync.WaitGroup),
-		inchan:  make(chan T, size),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: newStageMetrics(b.Clock),
+		inchan:  make(chan T, b.chanSize(size)),
 		outchan: make(chan T, CHANSIZE)}
 
-	r.wg.Add(1)
-	go r.mainloop()
+	if err := r.start(); err != nil {
+		return nil, err
+	}
 
 	return &r, nil
 }
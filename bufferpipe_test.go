@@ -1 +1,132 @@
 package pipelines_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+func ExampleBufferPipe_New() {
+	b, _ := pipelines.BufferPipe[int]{}.New(2)
+
+	b.InChan() <- 1
+	b.InChan() <- 2
+
+	fmt.Println(<-b.OutChan(), <-b.OutChan())
+
+	b.Close()
+	// Output:
+	// 1 2
+}
+
+// Cancelling the parent context stops every stage made with it
+func ExampleBufferPipe_NewWithContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	in := make(chan int)
+	b, _ := pipelines.BufferPipe[int]{}.NewWithContext(ctx, 1, in)
+	c := pipelines.ConverterPipe[int, string]{}.NewWithContext(ctx, b.PipelineChan(),
+		func(i int) (string, error) {
+			return fmt.Sprint("got ", i), nil
+		})
+
+	in <- 1
+	fmt.Println(<-c.OutChan())
+
+	cancel()
+	<-b.Done()
+	<-c.Done()
+
+	_, ok := <-c.OutChan()
+	fmt.Println(ok)
+	// Output:
+	// got 1
+	// false
+}
+
+// A pipelined stage made with a context keeps its upstream, so Close and Drain still
+// reach it, and stops with the rest when the context is cancelled
+func ExampleBufferPipe_pipelinecontext() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b, _ := pipelines.BufferPipe[int]{}.NewWithContext(ctx, 1, make(chan int, 1))
+	c := pipelines.ConverterPipe[int, string]{}.NewWithPipelineContext(ctx, b,
+		func(i int) (string, error) {
+			return fmt.Sprint("got ", i), nil
+		})
+
+	b.InChan() <- 1
+	fmt.Println(<-c.OutChan(), len(c.Upstreams()))
+
+	cancel()
+	<-b.Done()
+	<-c.Done()
+	// Output:
+	// got 1 1
+}
+
+// With no one reading, the oldest items are thrown away to make room
+func ExampleBufferPipe_dropoldest() {
+	b, _ := pipelines.BufferPipe[int]{Policy: pipelines.OVERFLOWDROPOLDEST}.New(3)
+
+	for i := 1; i <= 5; i++ {
+		b.InChan() <- i
+	}
+
+	fmt.Println(<-b.OutChan(), <-b.OutChan(), <-b.OutChan(), b.Dropped())
+
+	b.Close()
+	// Output:
+	// 3 4 5 2
+}
+
+func ExampleBufferPipe_dropnewest() {
+	b, _ := pipelines.BufferPipe[int]{Policy: pipelines.OVERFLOWDROPNEWEST}.New(3)
+
+	for i := 1; i <= 5; i++ {
+		b.InChan() <- i
+	}
+
+	fmt.Println(<-b.OutChan(), <-b.OutChan(), <-b.OutChan(), b.Dropped())
+
+	b.Close()
+	// Output:
+	// 1 2 3 2
+}
+
+func ExampleBufferPipe_timeout() {
+	clock := pipelines.NewFakeClock(time.Unix(0, 0))
+	b, _ := pipelines.BufferPipe[int]{Policy: pipelines.OVERFLOWTIMEOUT, Timeout: time.Second, Clock: clock}.New(1)
+
+	// 2 waits for room and is dropped when the timeout passes
+	b.InChan() <- 1
+	b.InChan() <- 2
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	// 3 waits for room and gets it when we read
+	b.InChan() <- 3
+	fmt.Println(<-b.OutChan(), <-b.OutChan(), b.Dropped())
+
+	b.Close()
+	// Output:
+	// 1 3 1
+}
+
+func TestBufferPipeConformance_dropoldest(t *testing.T) {
+	pipetest.Suite[int, int]{
+		New: func(in pipelines.Pipeline[int]) pipelines.Pipeline[int] {
+			b, _ := pipelines.BufferPipe[int]{Policy: pipelines.OVERFLOWDROPOLDEST}.NewWithPipeline(10, in)
+			return b
+		},
+		NewWithContext: func(ctx context.Context, in chan int) pipelines.Pipeline[int] {
+			b, _ := pipelines.BufferPipe[int]{Policy: pipelines.OVERFLOWDROPOLDEST}.NewWithContext(ctx, 10, in)
+			return b
+		},
+		Item: func(i int) int { return i },
+	}.Run(t)
+}
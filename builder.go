@@ -0,0 +1,222 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrDuplicateStage = errors.New("duplicate stage name")
+	ErrNilStage       = errors.New("stage returned nil")
+)
+
+// Stage builds a pipe that reads from the given pipeline
+type Stage[I, O any] func(Pipeline[I]) (Pipeline[O], error)
+
+// Sink builds the last pipe of a chain, it only needs to be closable
+type Sink[T any] func(Pipeline[T]) (Closer, error)
+
+// Wrap makes a Stage from a constructor that can not fail, such as
+// ThrottlePipe[int]{}.NewWithPipeline
+func Wrap[I, O any, P Pipeline[O]](fun func(Pipeline[I]) P) Stage[I, O] {
+	return func(p Pipeline[I]) (Pipeline[O], error) {
+		return fun(p), nil
+	}
+}
+
+// WrapErr makes a Stage from a constructor that returns an error
+func WrapErr[I, O any, P Pipeline[O]](fun func(Pipeline[I]) (P, error)) Stage[I, O] {
+	return func(p Pipeline[I]) (Pipeline[O], error) {
+		r, err := fun(p)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+// WrapSink makes a Sink from a constructor, such as NullConsumePipe[int]{}.NewWithPipeline
+func WrapSink[T any, P Closer](fun func(Pipeline[T]) P) Sink[T] {
+	return func(p Pipeline[T]) (Closer, error) {
+		return fun(p), nil
+	}
+}
+
+// isNil is true for nil and for an interface holding a nil pointer, such as a
+// constructor that returned a nil *BufferPipe with no error
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface, reflect.Slice:
+		return r.IsNil()
+	}
+	return false
+}
+
+// stages is shared by every link of a chain, it holds the pipes by name
+type stages struct {
+	names  []string
+	byname map[string]any
+	err    error
+}
+
+func (s *stages) add(name string, p any) error {
+	if _, ok := s.byname[name]; ok {
+		return ErrDuplicateStage
+	}
+	if isNil(p) {
+		return ErrNilStage
+	}
+
+	s.names = append(s.names, name)
+	s.byname[name] = p
+	return nil
+}
+
+// Chain is a pipeline being built, T is the type coming out of the last stage.
+// If a stage fails the stages built so far are closed and the error is
+// returned from To or Build
+type Chain[T any] struct {
+	stages *stages
+	tail   Pipeline[T]
+}
+
+// From starts a chain with src as the first stage
+func From[T any](name string, src Pipeline[T]) *Chain[T] {
+	c := &Chain[T]{stages: &stages{byname: make(map[string]any)}, tail: src}
+	if isNil(src) {
+		c.stages.err = fmt.Errorf("stage %v: %w", name, ErrNilStage)
+	} else {
+		c.stages.add(name, src)
+	}
+	return c
+}
+
+// Then adds a stage that does not change the type
+func (c *Chain[T]) Then(name string, stage Stage[T, T]) *Chain[T] {
+	return Via(c, name, stage)
+}
+
+// Via adds a stage that changes the type from I to O.  Go does not allow
+// methods to have type parameters so this is a function.
+func Via[I, O any](c *Chain[I], name string, stage Stage[I, O]) *Chain[O] {
+	r := &Chain[O]{stages: c.stages}
+	if c.stages.err != nil {
+		return r
+	}
+
+	p, err := stage(c.tail)
+	if err == nil {
+		err = c.stages.add(name, p)
+	}
+	if err != nil {
+		if !isNil(p) {
+			p.Close()
+		} else {
+			c.tail.Close()
+		}
+		c.stages.err = fmt.Errorf("stage %v: %w", name, err)
+		return r
+	}
+
+	r.tail = p
+	return r
+}
+
+// To ends the chain with a sink and returns the handle to the whole chain
+func (c *Chain[T]) To(name string, sink Sink[T]) (*Handle, error) {
+	if c.stages.err != nil {
+		return nil, c.stages.err
+	}
+
+	s, err := sink(c.tail)
+	if err == nil {
+		err = c.stages.add(name, s)
+	}
+	if err != nil {
+		if !isNil(s) {
+			s.Close()
+		} else {
+			c.tail.Close()
+		}
+		c.stages.err = fmt.Errorf("stage %v: %w", name, err)
+		return nil, c.stages.err
+	}
+
+	return newHandle(c.stages, s), nil
+}
+
+// Build ends the chain without a sink, the caller reads from the returned pipeline
+func (c *Chain[T]) Build() (*Handle, Pipeline[T], error) {
+	if c.stages.err != nil {
+		return nil, nil, c.stages.err
+	}
+
+	return newHandle(c.stages, c.tail), c.tail, nil
+}
+
+// Handle controls a built chain through its last stage
+type Handle struct {
+	stages *stages
+	tail   Closer
+
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newHandle(s *stages, tail Closer) *Handle {
+	return &Handle{stages: s, tail: tail, closed: make(chan struct{}), once: new(sync.Once)}
+}
+
+// Close shuts down the chain, each stage closes the one before it
+func (h *Handle) Close() {
+	h.once.Do(func() {
+		h.tail.Close()
+		close(h.closed)
+	})
+}
+
+// Drain lets the items in the chain flow out before we shut down, see Drainer.
+// If the last stage is not a Drainer this is the same as Close
+func (h *Handle) Drain(ctx context.Context) error {
+	var err error
+	h.once.Do(func() {
+		if d, ok := h.tail.(Drainer); ok {
+			err = d.Drain(ctx)
+		} else {
+			h.tail.Close()
+		}
+		close(h.closed)
+	})
+	return err
+}
+
+// Wait blocks until the last stage has stopped, or until Close when it can not tell us
+func (h *Handle) Wait() {
+	if d, ok := h.tail.(interface{ Done() <-chan struct{} }); ok {
+		<-d.Done()
+		return
+	}
+	<-h.closed
+}
+
+// Names returns the stage names in the order they were added
+func (h *Handle) Names() []string {
+	return append([]string(nil), h.stages.names...)
+}
+
+// Stage returns the pipe added with name, or nil
+func (h *Handle) Stage(name string) any {
+	return h.stages.byname[name]
+}
+
+// StageOf returns the pipe added with name as type P
+func StageOf[P any](h *Handle, name string) (P, bool) {
+	p, ok := h.stages.byname[name].(P)
+	return p, ok
+}
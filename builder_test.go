@@ -0,0 +1,94 @@
+package pipelines_test
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleFrom() {
+	src := pipelines.ThrottlePipe[int]{}.New()
+
+	h, out, err := pipelines.Via(
+		pipelines.From[int]("throttle", src).
+			Then("buffer", func(p pipelines.Pipeline[int]) (pipelines.Pipeline[int], error) {
+				return pipelines.BufferPipe[int]{}.NewWithPipeline(5, p)
+			}),
+		"itoa", pipelines.Wrap[int, string](func(p pipelines.Pipeline[int]) *pipelines.ConverterPipe[int, string] {
+			return pipelines.ConverterPipe[int, string]{}.NewWithPipeline(p,
+				func(i int) (string, error) { return "#" + strconv.Itoa(i), nil })
+		})).
+		Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer h.Close()
+
+	src.AddTok() <- 3
+	for i := 1; i <= 3; i++ {
+		src.InChan() <- i
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Print(<-out.PipelineChan(), " ")
+	}
+
+	_, ok := pipelines.StageOf[*pipelines.BufferPipe[int]](h, "buffer")
+	fmt.Println(h.Names(), ok)
+	// Output:
+	// #1 #2 #3 [throttle buffer itoa] true
+}
+
+func ExampleChain_To() {
+	in := make(chan int)
+
+	h, err := pipelines.From[int]("buffer", must(pipelines.BufferPipe[int]{}.NewWithChannel(5, in))).
+		To("null", pipelines.WrapSink(pipelines.NullConsumePipe[int]{}.NewWithPipeline))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	in <- 1
+	in <- 2
+	close(in)
+
+	// The sink stops once the buffer closes its output
+	h.Wait()
+	h.Close()
+	fmt.Println("done")
+	// Output:
+	// done
+}
+
+func ExampleChain_Then() {
+	_, err := pipelines.From[int]("a", pipelines.ThrottlePipe[int]{}.New()).
+		Then("a", pipelines.Wrap[int, int](pipelines.ThrottlePipe[int]{}.NewWithPipeline)).
+		To("null", pipelines.WrapSink(pipelines.NullConsumePipe[int]{}.NewWithPipeline))
+
+	fmt.Println(errors.Is(err, pipelines.ErrDuplicateStage), err)
+	// Output:
+	// true stage a: duplicate stage name
+}
+
+// A constructor that returns a nil pipe is an error, not a panic when the chain is closed
+func ExampleWrap_nil() {
+	_, err := pipelines.From[int]("a", pipelines.ThrottlePipe[int]{}.New()).
+		Then("b", pipelines.Wrap[int, int](func(pipelines.Pipeline[int]) *pipelines.BufferPipe[int] {
+			return nil
+		})).
+		To("null", pipelines.WrapSink(pipelines.NullConsumePipe[int]{}.NewWithPipeline))
+
+	fmt.Println(errors.Is(err, pipelines.ErrNilStage), err)
+	// Output:
+	// true stage b: stage returned nil
+}
+
+func must[T any](t T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,264 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ByteBufferPipe holds items until their total Size reaches maxBytes.  Policy chooses
+// what happens to an item that does not fit, for OVERFLOWBLOCK and OVERFLOWTIMEOUT
+// we stop reading the input until it does.  An item always fits when we are empty,
+// so one bigger than maxBytes is let through on its own.
+type ByteBufferPipe[T Sizer] struct {
+	// Policy is used when we are full, Timeout is how long OVERFLOWTIMEOUT waits
+	Policy  OverflowPolicy
+	Timeout time.Duration
+
+	// Clock is used for Timeout, nil is RealClock
+	Clock Clock
+
+	// bytes is a pointer so the value receivers don't copy it while we update it
+	maxBytes int
+	bytes    *int64
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// InChan
+func (b ByteBufferPipe[T]) InChan() chan<- T {
+	return b.inchan
+}
+
+// OutChan
+func (b ByteBufferPipe[T]) OutChan() <-chan T {
+	return b.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (b ByteBufferPipe[T]) PipelineChan() chan T {
+	return b.outchan
+}
+
+// Close
+func (b *ByteBufferPipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if b.pl != nil {
+		b.pl.Close()
+	}
+
+	// Cancel our context
+	b.can()
+
+	// Wait for us to be done
+	b.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (b ByteBufferPipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *ByteBufferPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// Bytes returns the total Size of the items we hold
+func (b *ByteBufferPipe[_]) Bytes() int {
+	return int(atomic.LoadInt64(b.bytes))
+}
+
+// Dropped returns the number of items we have thrown away because we were full
+func (b *ByteBufferPipe[_]) Dropped() uint64 {
+	return atomic.LoadUint64(&b.metrics.ndropped)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *ByteBufferPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *ByteBufferPipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *ByteBufferPipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
+// fits returns true if we have room for n more bytes, items is how many we hold
+func (b *ByteBufferPipe[_]) fits(items, n int) bool {
+	return items == 0 || int(atomic.LoadInt64(b.bytes))+n <= b.maxBytes
+}
+
+// mainloop, read from in channel and hold the items while they fit, write the oldest
+// to the out channel.  On input close we send what we hold, exit when our context is closed
+func (b *ByteBufferPipe[T]) mainloop() {
+	defer close(b.done)
+	defer b.wg.Done()
+	defer close(b.outchan)
+
+	var queue []T
+
+	// waiting is an item that did not fit, we don't read the input while we have one
+	var waiting *T
+	var timer Timer
+	var timeout <-chan time.Time
+
+	push := func(t T) {
+		queue = append(queue, t)
+		atomic.AddInt64(b.bytes, int64(t.Size()))
+	}
+
+	in := b.inchan
+	stop := b.drain.ch
+	for {
+		if waiting != nil && b.fits(len(queue), (*waiting).Size()) {
+			push(*waiting)
+			waiting = nil
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+		}
+		held := len(queue)
+		if waiting != nil {
+			held++
+		}
+		b.metrics.depth(held)
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && held == 0 {
+			return
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if len(queue) > 0 {
+			out, head = b.outchan, queue[0]
+			b.metrics.sending()
+		} else {
+			b.metrics.receiving()
+		}
+
+		read := in
+		if waiting != nil {
+			read = nil
+		}
+
+		select {
+		case out <- head:
+			queue = popFront(queue)
+			atomic.AddInt64(b.bytes, -int64(head.Size()))
+			b.metrics.out()
+		case t, ok := <-read:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			b.metrics.in()
+
+			n := t.Size()
+			if b.fits(len(queue), n) {
+				push(t)
+				break
+			}
+			switch b.Policy {
+			case OVERFLOWDROPNEWEST:
+				b.metrics.dropped(1)
+			case OVERFLOWDROPOLDEST:
+				for !b.fits(len(queue), n) {
+					atomic.AddInt64(b.bytes, -int64(queue[0].Size()))
+					queue = popFront(queue)
+					b.metrics.dropped(1)
+				}
+				push(t)
+			case OVERFLOWTIMEOUT:
+				timer = b.Clock.NewTimer(b.Timeout)
+				timeout = timer.C()
+				waiting = &t
+			default:
+				waiting = &t
+			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			waiting = nil
+			b.metrics.dropped(1)
+		case <-stop:
+			stop = nil
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b ByteBufferPipe[T]) NewWithChannel(maxBytes int, in chan T) (*ByteBufferPipe[T], error) {
+	return b.NewWithContext(context.Background(), maxBytes, in)
+}
+
+func (b ByteBufferPipe[T]) NewWithContext(ctx context.Context, maxBytes int, in chan T) (*ByteBufferPipe[T], error) {
+	if maxBytes < 1 {
+		return nil, errors.New("buffer bytes must be >= 1")
+	}
+	if b.Policy < OVERFLOWBLOCK || b.Policy > OVERFLOWTIMEOUT {
+		return nil, fmt.Errorf("unknown overflow policy %v", b.Policy)
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := ByteBufferPipe[T]{
+		Policy:   b.Policy,
+		Timeout:  b.Timeout,
+		Clock:    orRealClock(b.Clock),
+		maxBytes: maxBytes,
+		bytes:    new(int64),
+		ctx:      con,
+		can:      cancel,
+		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{}),
+		drain:    newSignal(),
+		metrics:  newStageMetrics(b.Clock),
+		inchan:   in,
+		outchan:  make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (b ByteBufferPipe[T]) NewWithPipeline(maxBytes int, p Pipeline[T]) (*ByteBufferPipe[T], error) {
+	return b.NewWithPipelineContext(context.Background(), maxBytes, p)
+}
+
+func (b ByteBufferPipe[T]) NewWithPipelineContext(ctx context.Context, maxBytes int, p Pipeline[T]) (*ByteBufferPipe[T], error) {
+	r, err := b.NewWithContext(ctx, maxBytes, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (b ByteBufferPipe[T]) New(maxBytes int) (*ByteBufferPipe[T], error) {
+	return b.NewWithChannel(maxBytes, make(chan T, CHANSIZE))
+}
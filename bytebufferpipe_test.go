@@ -0,0 +1,58 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+func packet(s string) pipelines.Packet {
+	return pipelines.Packet{DataSlice: []byte(s)}
+}
+
+// The third packet waits until there is room for it
+func ExampleByteBufferPipe_New() {
+	b, _ := pipelines.ByteBufferPipe[pipelines.Packet]{}.New(10)
+
+	b.InChan() <- packet("hello")
+	b.InChan() <- packet("world")
+	go func() {
+		b.InChan() <- packet("!")
+	}()
+
+	for i := 0; i < 3; i++ {
+		fmt.Println(string((<-b.OutChan()).Data()))
+	}
+
+	b.Close()
+	// Output:
+	// hello
+	// world
+	// !
+}
+
+// With no one reading, the oldest packets are thrown away to make room
+func ExampleByteBufferPipe_dropoldest() {
+	b, _ := pipelines.ByteBufferPipe[pipelines.Packet]{Policy: pipelines.OVERFLOWDROPOLDEST}.New(10)
+
+	b.InChan() <- packet("hello")
+	b.InChan() <- packet("world")
+	b.InChan() <- packet("again")
+
+	fmt.Println(string((<-b.OutChan()).Data()), string((<-b.OutChan()).Data()), b.Dropped())
+
+	b.Close()
+	// Output:
+	// world again 1
+}
+
+func TestByteBufferPipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) pipelines.Packet { return pipelines.Packet{DataSlice: []byte(strconv.Itoa(i))} },
+		func(in pipelines.Pipeline[pipelines.Packet]) pipelines.Pipeline[pipelines.Packet] {
+			b, _ := pipelines.ByteBufferPipe[pipelines.Packet]{}.NewWithPipeline(20, in)
+			return b
+		})
+}
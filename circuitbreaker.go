@@ -0,0 +1,262 @@
+package pipelines
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// BREAKERWINDOW is how far back a CircuitBreaker looks at the failure rate
+	BREAKERWINDOW = 10 * time.Second
+	// BREAKERCOOLDOWN is how long a CircuitBreaker stays open before it tries again
+	BREAKERCOOLDOWN = 30 * time.Second
+	// BREAKERMINCALLS is the number of calls in the window needed before a CircuitBreaker can open
+	BREAKERMINCALLS = 10
+	// BREAKERFAILURERATE is the fraction of calls that must fail for a CircuitBreaker to open
+	BREAKERFAILURERATE = 0.5
+
+	// the window is counted in this many buckets
+	breakerBuckets = 10
+)
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	// BREAKERCLOSED calls the function, this is where a breaker starts
+	BREAKERCLOSED = BreakerState(0)
+	// BREAKEROPEN does not call the function until the cooldown is over
+	BREAKEROPEN = BreakerState(1)
+	// BREAKERHALFOPEN lets a few trial calls through to see if the function works again
+	BREAKERHALFOPEN = BreakerState(2)
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BREAKERCLOSED:
+		return "closed"
+	case BREAKEROPEN:
+		return "open"
+	case BREAKERHALFOPEN:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// ErrCircuitOpen is returned for items the breaker did not pass to the function
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker wraps a ConverterPipe function.  While closed it calls the function and
+// counts the failures, once FailureRate of the calls in the last Window fail it opens.
+// While open items are not passed to the function, they go to Fallback or fail with
+// ErrCircuitOpen, so they come out of the converter's ErrChan or ErrPipeline as dead
+// letters.  After Cooldown it is half open and lets HalfOpenCalls trial calls through,
+// if they all work it closes, if one fails it opens again.
+//
+// It is safe to use from the workers of a parallel ConverterPipe, for example
+// cb := CircuitBreaker[I, O]{Cooldown: time.Minute}.New(fun)
+// ConverterPipe[I, O]{}.NewParallel(4, true, cb.Convert)
+type CircuitBreaker[I, O any] struct {
+	// FailureRate is the fraction of calls that must fail to open, 0 is BREAKERFAILURERATE
+	FailureRate float64
+
+	// MinCalls is the number of calls in the Window needed before we can open, 0 is BREAKERMINCALLS
+	MinCalls int
+
+	// Window is how far back we look at the failure rate, 0 is BREAKERWINDOW
+	Window time.Duration
+
+	// Cooldown is how long we stay open, 0 is BREAKERCOOLDOWN
+	Cooldown time.Duration
+
+	// HalfOpenCalls is the number of trial calls that must work to close, 0 is 1
+	HalfOpenCalls int
+
+	// Fallback converts the items while we are open, nil fails them with ErrCircuitOpen
+	Fallback func(I) (O, error)
+
+	// OnStateChange is called after each change of state, it must not block for long
+	OnStateChange func(from, to BreakerState)
+
+	// Clock is used for Window and Cooldown, nil is RealClock
+	Clock Clock
+
+	fun   func(I) (O, error)
+	start time.Time
+
+	mu       *sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+
+	// gen goes up on each change of state, a call only counts in the gen it was let through in
+	gen     uint64
+	buckets [breakerBuckets]breakerBucket
+
+	// trials is the number of half open calls let through, passed the number that worked
+	trials int
+	passed int
+}
+
+// breakerBucket counts the calls in one slice of the window, num says which slice
+type breakerBucket struct {
+	num   int64
+	calls int
+	fails int
+}
+
+// State returns the state we are in now
+func (b *CircuitBreaker[_, _]) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Convert calls the function if the breaker lets it through, pass it to ConverterPipe
+func (b *CircuitBreaker[I, O]) Convert(i I) (O, error) {
+	allow, gen, changes := b.allow()
+	b.notify(changes)
+
+	if !allow {
+		if b.Fallback != nil {
+			return b.Fallback(i)
+		}
+		var o O
+		return o, ErrCircuitOpen
+	}
+
+	o, err := b.fun(i)
+	b.notify(b.record(gen, err != nil))
+	return o, err
+}
+
+// breakerChange is a change of state to report once we let go of the lock
+type breakerChange struct {
+	from, to BreakerState
+}
+
+func (b *CircuitBreaker[_, _]) notify(changes []breakerChange) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.OnStateChange(c.from, c.to)
+	}
+}
+
+// set changes state, must hold the lock
+func (b *CircuitBreaker[_, _]) set(to BreakerState, changes []breakerChange) []breakerChange {
+	changes = append(changes, breakerChange{from: b.state, to: to})
+	b.state = to
+	b.gen++
+
+	switch to {
+	case BREAKEROPEN:
+		b.openedAt = b.Clock.Now()
+	case BREAKERHALFOPEN:
+		b.trials, b.passed = 0, 0
+	case BREAKERCLOSED:
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+	return changes
+}
+
+// allow returns true if a call can go through and the gen to pass to record
+func (b *CircuitBreaker[_, _]) allow() (bool, uint64, []breakerChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var changes []breakerChange
+	if b.state == BREAKEROPEN {
+		if b.Clock.Since(b.openedAt) < b.Cooldown {
+			return false, b.gen, nil
+		}
+		changes = b.set(BREAKERHALFOPEN, changes)
+	}
+
+	if b.state == BREAKERHALFOPEN {
+		if b.trials >= b.HalfOpenCalls {
+			return false, b.gen, changes
+		}
+		b.trials++
+	}
+	return true, b.gen, changes
+}
+
+// record counts the result of a call let through in gen and changes state if needed
+func (b *CircuitBreaker[_, _]) record(gen uint64, failed bool) []breakerChange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A call that started before the last change of state doesn't count, such as one
+	// let through while closed that ends once we are half open
+	if gen != b.gen {
+		return nil
+	}
+
+	switch b.state {
+	case BREAKERHALFOPEN:
+		if failed {
+			return b.set(BREAKEROPEN, nil)
+		}
+		b.passed++
+		if b.passed >= b.HalfOpenCalls {
+			return b.set(BREAKERCLOSED, nil)
+		}
+	case BREAKERCLOSED:
+		width := b.Window / breakerBuckets
+		if width <= 0 {
+			width = 1
+		}
+		num := int64(b.Clock.Since(b.start) / width)
+		bk := &b.buckets[num%breakerBuckets]
+		if bk.num != num {
+			*bk = breakerBucket{num: num}
+		}
+		bk.calls++
+		if failed {
+			bk.fails++
+		}
+
+		calls, fails := 0, 0
+		for _, bk := range b.buckets {
+			if bk.num > num-breakerBuckets {
+				calls += bk.calls
+				fails += bk.fails
+			}
+		}
+		if failed && calls >= b.MinCalls && float64(fails) >= b.FailureRate*float64(calls) {
+			return b.set(BREAKEROPEN, nil)
+		}
+	}
+	return nil
+}
+
+// New wraps fun, set the options before calling it
+func (b CircuitBreaker[I, O]) New(fun func(I) (O, error)) *CircuitBreaker[I, O] {
+	r := b
+	r.fun = fun
+	r.Clock = orRealClock(b.Clock)
+	r.start = r.Clock.Now()
+	r.mu = new(sync.Mutex)
+	r.state = BREAKERCLOSED
+
+	if r.FailureRate <= 0 {
+		r.FailureRate = BREAKERFAILURERATE
+	}
+	if r.MinCalls <= 0 {
+		r.MinCalls = BREAKERMINCALLS
+	}
+	if r.Window <= 0 {
+		r.Window = BREAKERWINDOW
+	}
+	if r.Cooldown <= 0 {
+		r.Cooldown = BREAKERCOOLDOWN
+	}
+	if r.HalfOpenCalls <= 0 {
+		r.HalfOpenCalls = 1
+	}
+
+	return &r
+}
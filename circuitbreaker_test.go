@@ -0,0 +1,133 @@
+package pipelines_test
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleCircuitBreaker() {
+	clock := pipelines.NewFakeClock(time.Time{})
+
+	down := true
+	lookup := func(i int) (string, error) {
+		if down {
+			return "", errors.New("service down")
+		}
+		return strconv.Itoa(i), nil
+	}
+
+	cb := pipelines.CircuitBreaker[int, string]{
+		MinCalls: 2,
+		Cooldown: 10 * time.Second,
+		Clock:    clock,
+		OnStateChange: func(from, to pipelines.BreakerState) {
+			fmt.Println(from, "->", to)
+		},
+	}.New(lookup)
+
+	// Two failures open the breaker, the third call is not made
+	for i := 1; i <= 3; i++ {
+		_, err := cb.Convert(i)
+		fmt.Println(err)
+	}
+
+	// After the cooldown a trial call is let through and it works
+	clock.Advance(10 * time.Second)
+	down = false
+	fmt.Println(cb.Convert(4))
+	// Output:
+	// service down
+	// closed -> open
+	// service down
+	// circuit breaker is open
+	// open -> half-open
+	// half-open -> closed
+	// 4 <nil>
+}
+
+// While open the items come out of the converter's error channel as dead letters
+func ExampleCircuitBreaker_deadletter() {
+	cb := pipelines.CircuitBreaker[int, string]{MinCalls: 1}.New(func(int) (string, error) {
+		return "", errors.New("service down")
+	})
+
+	c := pipelines.ConverterPipe[int, string]{}.New(cb.Convert)
+	errs := c.ErrChan()
+
+	for i := 1; i <= 3; i++ {
+		c.InChan() <- i
+		e := <-errs
+		fmt.Println(e.Input, e.Err, errors.Is(e, pipelines.ErrCircuitOpen))
+	}
+	fmt.Println(cb.State())
+
+	c.Close()
+	// Output:
+	// 1 service down false
+	// 2 circuit breaker is open true
+	// 3 circuit breaker is open true
+	// open
+}
+
+// A fallback answers for the items while the breaker is open
+func ExampleCircuitBreaker_fallback() {
+	cb := pipelines.CircuitBreaker[int, string]{
+		MinCalls: 1,
+		Fallback: func(i int) (string, error) { return "cached " + strconv.Itoa(i), nil },
+	}.New(func(int) (string, error) {
+		return "", errors.New("service down")
+	})
+
+	for i := 1; i <= 2; i++ {
+		fmt.Println(cb.Convert(i))
+	}
+	// Output:
+	// service down
+	// cached 2 <nil>
+}
+
+// A call let through while closed that ends once we are half open is not a trial
+func ExampleCircuitBreaker_stale() {
+	clock := pipelines.NewFakeClock(time.Time{})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	cb := pipelines.CircuitBreaker[int, string]{
+		MinCalls:      1,
+		HalfOpenCalls: 2,
+		Cooldown:      10 * time.Second,
+		Clock:         clock,
+	}.New(func(i int) (string, error) {
+		switch {
+		case i == 0:
+			close(started)
+			<-release
+		case i < 0:
+			return "", errors.New("service down")
+		}
+		return strconv.Itoa(i), nil
+	})
+
+	// The slow call starts while we are closed
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		cb.Convert(0)
+	}()
+	<-started
+
+	cb.Convert(-1)
+	clock.Advance(10 * time.Second)
+	fmt.Println(cb.Convert(1))
+
+	// It works, but only the trial counts, so we stay half open
+	close(release)
+	<-slow
+	fmt.Println(cb.State())
+	// Output:
+	// 1 <nil>
+	// half-open
+}
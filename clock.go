@@ -0,0 +1,205 @@
+package pipelines
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source for the stages that wait, retry or expire things.  Set it
+// on the stage before calling New, for example RetryPipe[K, T]{Clock: c}.New(),
+// a nil Clock is RealClock.  Tests use a FakeClock so they don't have to wait.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer from a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker is a time.Ticker from a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the time package
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// orRealClock returns c or RealClock if c is nil
+func orRealClock(c Clock) Clock {
+	if c == nil {
+		return RealClock
+	}
+	return c
+}
+
+// FakeClock only moves when Advance is called.  Timers and tickers fire during
+// Advance, in order, with Now set to the time they were due.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a timer or, if period is set, a ticker
+type fakeTimer struct {
+	clock  *FakeClock
+	c      chan time.Time
+	when   time.Time
+	period time.Duration
+}
+
+// NewFakeClock returns a clock stopped at start
+func NewFakeClock(start time.Time) *FakeClock {
+	f := &FakeClock{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0)
+}
+
+// NewTicker panics if d <= 0, the same as time.NewTicker
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(d, d)}
+}
+
+func (f *FakeClock) add(d, period time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1), when: f.now.Add(d), period: period}
+	if d <= 0 {
+		t.c <- f.now
+		return t
+	}
+
+	f.timers = append(f.timers, t)
+	f.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d firing the timers that come due
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+	for {
+		// Find the next one due
+		next := -1
+		for i, t := range f.timers {
+			if !t.when.After(end) && (next < 0 || t.when.Before(f.timers[next].when)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		t := f.timers[next]
+		f.now = t.when
+		// Like time.Ticker we drop ticks for a slow reader
+		select {
+		case t.c <- f.now:
+		default:
+		}
+
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			f.remove(next)
+		}
+	}
+	f.now = end
+}
+
+// BlockUntil waits until there are n timers and tickers waiting to fire, so a test
+// knows a stage is waiting on the clock before it calls Advance
+func (f *FakeClock) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+// remove the i'th timer, must hold the lock
+func (f *FakeClock) remove(i int) {
+	f.timers = append(f.timers[:i], f.timers[i+1:]...)
+}
+
+// stop removes t, returns true if it had not fired
+func (f *FakeClock) stop(t *fakeTimer) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.timers {
+		if f.timers[i] == t {
+			f.remove(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t)
+}
+
+// fakeTicker is a fakeTimer with a period, its Stop has no result
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
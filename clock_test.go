@@ -0,0 +1,61 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleFakeClock() {
+	clock := pipelines.NewFakeClock(time.Unix(0, 0))
+	retry := pipelines.RetryPipe[rptKeyType, *Obj]{Clock: clock}.New()
+
+	retry.InChan() <- &Obj{Sn: 1}
+	fmt.Println(clock.Since(time.Unix(0, 0)), (<-retry.OutChan()).Key())
+
+	// Each time wait for the retry timer before moving the clock
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(pipelines.RETRYTIME)
+		fmt.Println(clock.Since(time.Unix(0, 0)), (<-retry.OutChan()).Key())
+	}
+
+	// The next timer is at the expire time, once past it the retry is dropped
+	clock.BlockUntil(1)
+	clock.Advance(pipelines.EXPIRETIME - 2*pipelines.RETRYTIME + time.Second)
+	for retry.Stats().Dropped == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Println(clock.Since(time.Unix(0, 0)), "expired")
+
+	retry.Close()
+	// Output:
+	// 0s 1
+	// 13s 1
+	// 26s 1
+	// 36s expired
+}
+
+func ExampleOnlyOncePipe_clock() {
+	clock := pipelines.NewFakeClock(time.Unix(0, 0))
+	once := pipelines.OnlyOncePipe[int]{Clock: clock}.New(time.Second, 5*time.Second)
+
+	once.InChan() <- 1
+	fmt.Println(<-once.OutChan())
+	once.InChan() <- 1
+
+	// After the forget time the next GC tick removes it and we see it again
+	clock.BlockUntil(1)
+	clock.Advance(6 * time.Second)
+	for once.Stats().Held > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	once.InChan() <- 1
+	fmt.Println(<-once.OutChan(), once.Stats().Dropped)
+
+	once.Close()
+	// Output:
+	// 1
+	// 1 1
+}
@@ -0,0 +1,258 @@
+package pipelines
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoalescePipe holds the latest item for each key and sends it once no update for the
+// key has come in for quiet.  With MaxWait set a key that keeps getting updates is sent
+// MaxWait after its first one, this is needed when updates come more often than quiet,
+// such as DirScan sending the same names every ScanTime.  An update that comes in after
+// the item is due, but before it is sent, is added to it.
+//
+// Set the options before calling New, for example
+// CoalescePipe[K, T]{MaxWait: time.Minute, Merge: f}.New(time.Second)
+type CoalescePipe[K comparable, T Keyer[K]] struct {
+	// Merge combines the item we hold with an update for the same key, nil keeps the update
+	Merge func(held, update T) T
+
+	// MaxWait is the longest we hold a key from its first update, 0 is no limit
+	MaxWait time.Duration
+
+	// Clock is used for quiet and MaxWait, nil is RealClock
+	Clock Clock
+
+	quiet time.Duration
+
+	// merged is a pointer so the value receivers don't copy it while we update it
+	merged *uint64
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// coalesced is the item we hold for a key and when its first update came in
+type coalesced[T any] struct {
+	*delayed[T]
+	first time.Time
+}
+
+// InChan
+func (c CoalescePipe[_, T]) InChan() chan<- T {
+	return c.inchan
+}
+
+// OutChan
+func (c CoalescePipe[_, T]) OutChan() <-chan T {
+	return c.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (c CoalescePipe[_, T]) PipelineChan() chan T {
+	return c.outchan
+}
+
+// Close
+func (c *CoalescePipe[_, _]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if c.pl != nil {
+		c.pl.Close()
+	}
+
+	// Cancel our context
+	c.can()
+
+	// Wait for us to be done
+	c.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (c CoalescePipe[_, _]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Drain lets the items we hold flow out as they come due before we shut down, see Drainer
+func (c *CoalescePipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, c.pl, c.drain, c.done, c.can, c.wg)
+}
+
+// Merged returns the number of updates added to an item we already held
+func (c *CoalescePipe[_, _]) Merged() uint64 {
+	return atomic.LoadUint64(c.merged)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (c *CoalescePipe[_, _]) SetMetrics(name string, m Metrics) {
+	c.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (c *CoalescePipe[_, _]) Stats() Stats {
+	return c.metrics.stats(c.done, len(c.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (c *CoalescePipe[_, _]) Upstreams() []any {
+	return upstreams(c.pl)
+}
+
+// due is quiet after the last update, but no later than MaxWait after the first
+func (c *CoalescePipe[_, _]) due(first, last time.Time) time.Time {
+	due := last.Add(c.quiet)
+	if c.MaxWait > 0 {
+		if max := first.Add(c.MaxWait); max.Before(due) {
+			return max
+		}
+	}
+	return due
+}
+
+// mainloop, read from in channel and hold the latest item for each key until it is due,
+// then write it to the out channel.  On input close we send what we hold as it comes due,
+// exit when our context is closed
+func (c *CoalescePipe[K, T]) mainloop() {
+	defer close(c.done)
+	defer c.wg.Done()
+	defer close(c.outchan)
+
+	var waiting delayHeap[T]
+	var ready []*delayed[T]
+	keys := make(map[K]coalesced[T])
+	var seq uint64
+
+	timer := dueTimer{clock: c.Clock}
+	defer timer.stop()
+
+	in := c.inchan
+	stop := c.drain.ch
+	for {
+		// Move the items that are due to the ready queue
+		ready = waiting.popDue(c.Clock.Now(), ready)
+
+		// Keep the timer set for the next one to come due
+		timer.set(waiting.next())
+
+		c.metrics.depth(len(keys))
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && len(keys) == 0 {
+			return
+		}
+
+		// Only select on the output when we have something due
+		var out chan T
+		var head T
+		if len(ready) > 0 {
+			out, head = c.outchan, ready[0].t
+			c.metrics.sending()
+		} else {
+			c.metrics.receiving()
+		}
+
+		select {
+		case out <- head:
+			delete(keys, head.Key())
+			ready = popFront(ready)
+			c.metrics.out()
+		case t, ok := <-in:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			c.metrics.in()
+
+			now := c.Clock.Now()
+			k := t.Key()
+			it, ok := keys[k]
+			if !ok {
+				it = coalesced[T]{delayed: &delayed[T]{t: t, due: c.due(now, now), seq: seq}, first: now}
+				seq++
+				keys[k] = it
+				heap.Push(&waiting, it.delayed)
+				break
+			}
+
+			// The update is merged into the one we hold, it is counted by Merged not as dropped
+			if c.Merge != nil {
+				t = c.Merge(it.t, t)
+			}
+			it.t = t
+			if it.index >= 0 {
+				it.due = c.due(it.first, now)
+				heap.Fix(&waiting, it.index)
+			}
+			atomic.AddUint64(c.merged, 1)
+		case <-timer.C:
+			timer.fired()
+		case <-stop:
+			stop = nil
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c CoalescePipe[K, T]) NewWithChannel(quiet time.Duration, in chan T) (*CoalescePipe[K, T], error) {
+	return c.NewWithContext(context.Background(), quiet, in)
+}
+
+func (c CoalescePipe[K, T]) NewWithContext(ctx context.Context, quiet time.Duration, in chan T) (*CoalescePipe[K, T], error) {
+	if quiet < 0 || c.MaxWait < 0 {
+		return nil, errors.New("coalesce quiet and max wait must be >= 0")
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := CoalescePipe[K, T]{
+		Merge:   c.Merge,
+		MaxWait: c.MaxWait,
+		Clock:   orRealClock(c.Clock),
+		quiet:   quiet,
+		merged:  new(uint64),
+		ctx:     con,
+		can:     cancel,
+		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: newStageMetrics(c.Clock),
+		inchan:  in,
+		outchan: make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (c CoalescePipe[K, T]) NewWithPipeline(quiet time.Duration, p Pipeline[T]) (*CoalescePipe[K, T], error) {
+	return c.NewWithPipelineContext(context.Background(), quiet, p)
+}
+
+func (c CoalescePipe[K, T]) NewWithPipelineContext(ctx context.Context, quiet time.Duration, p Pipeline[T]) (*CoalescePipe[K, T], error) {
+	r, err := c.NewWithContext(ctx, quiet, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (c CoalescePipe[K, T]) New(quiet time.Duration) (*CoalescePipe[K, T], error) {
+	return c.NewWithChannel(quiet, make(chan T, CHANSIZE))
+}
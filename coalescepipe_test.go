@@ -0,0 +1,74 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+type reading struct {
+	Sensor string
+	Value  int
+}
+
+func (r reading) Key() string {
+	return r.Sensor
+}
+
+// Only the latest reading for each sensor is sent once they go quiet
+func ExampleCoalescePipe() {
+	clock := pipelines.NewFakeClock(time.Time{})
+	c, _ := pipelines.CoalescePipe[string, reading]{Clock: clock}.New(time.Second)
+
+	c.InChan() <- reading{Sensor: "a", Value: 1}
+	c.InChan() <- reading{Sensor: "a", Value: 2}
+	c.InChan() <- reading{Sensor: "b", Value: 1}
+	for c.Stats().Held != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Second)
+	fmt.Println(<-c.OutChan(), <-c.OutChan())
+
+	c.Close()
+	// Output:
+	// {a 2} {b 1}
+}
+
+// Updates that never go quiet are merged and sent MaxWait after the first
+func ExampleCoalescePipe_maxwait() {
+	clock := pipelines.NewFakeClock(time.Time{})
+	c, _ := pipelines.CoalescePipe[string, reading]{
+		Clock:   clock,
+		MaxWait: 5 * time.Second,
+		Merge: func(held, update reading) reading {
+			update.Value += held.Value
+			return update
+		},
+	}.New(2 * time.Second)
+
+	for i := 0; i < 4; i++ {
+		c.InChan() <- reading{Sensor: "a", Value: 1}
+		for c.Stats().Held != 1 || c.Merged() != uint64(i) {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(1500 * time.Millisecond)
+	}
+
+	fmt.Println(<-c.OutChan(), c.Merged(), c.Stats().Dropped)
+
+	c.Close()
+	// Output:
+	// {a 4} 3 0
+}
+
+func TestCoalescePipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) node2 { return node2{key: i} },
+		func(in pipelines.Pipeline[node2]) pipelines.Pipeline[node2] {
+			c, _ := pipelines.CoalescePipe[int, node2]{}.NewWithPipeline(time.Millisecond, in)
+			return c
+		})
+}
@@ -0,0 +1,74 @@
+package pipelines
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// Codec turns items into bytes and back for the stages that keep them on disk
+type Codec[T any] interface {
+	Encode(t T) ([]byte, error)
+	Decode(b []byte) (T, error)
+}
+
+// JSONCodec uses encoding/json, it is the default Codec.  T needs exported fields
+// or its own json.Marshaler
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(t T) ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var t T
+	err := json.Unmarshal(b, &t)
+	return t, err
+}
+
+// PacketCodec keeps the address and data of a Packetable, it decodes to a Packet.
+// The layout is the IP length and IP, the port, the zone length and zone, then the data
+type PacketCodec struct{}
+
+// errShortPacket is a PacketCodec record that ends too soon
+var errShortPacket = errors.New("packet record too short")
+
+func (PacketCodec) Encode(p Packetable) ([]byte, error) {
+	addr := p.Address()
+	if len(addr.IP) > 255 || len(addr.Zone) > 255 {
+		return nil, errors.New("packet address too long")
+	}
+
+	b := make([]byte, 0, 1+len(addr.IP)+2+1+len(addr.Zone)+len(p.Data()))
+	b = append(b, byte(len(addr.IP)))
+	b = append(b, addr.IP...)
+	b = append(b, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(addr.Port))
+	b = append(b, byte(len(addr.Zone)))
+	b = append(b, addr.Zone...)
+	return append(b, p.Data()...), nil
+}
+
+func (PacketCodec) Decode(b []byte) (Packetable, error) {
+	var p Packet
+
+	if len(b) < 1 || len(b) < 1+int(b[0])+3 {
+		return nil, errShortPacket
+	}
+	if n := int(b[0]); n > 0 {
+		p.Addr.IP = net.IP(append([]byte(nil), b[1:1+n]...))
+	}
+	b = b[1+int(b[0]):]
+	p.Addr.Port = int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+
+	n := int(b[0])
+	if len(b) < 1+n {
+		return nil, errShortPacket
+	}
+	p.Addr.Zone = string(b[1 : 1+n])
+	p.DataSlice = append([]byte(nil), b[1+n:]...)
+
+	return p, nil
+}
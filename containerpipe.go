@@ -38,13 +38,19 @@ type ContainerPipe[K comparable, T Keyer[K]] struct {
 
 	approxSize int32
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 func (c *ContainerPipe[_, T]) addT(thing T) {
+	c.metrics.in()
+
 	k := thing.Key()
 	if _, b := c.tmap[k]; b {
+		c.metrics.dropped(1)
 		return
 	}
 
@@ -87,27 +93,27 @@ func (c *ContainerPipe[K, T]) pop() *T {
 
 // ApproxSize returns something close to the number of items in the container, maybe.
 // Only updated at the start of each mainloop
-func (c ContainerPipe[_, _]) ApproxSize() int32 {
+func (c *ContainerPipe[_, _]) ApproxSize() int32 {
 	return atomic.LoadInt32(&c.approxSize)
 }
 
 // InChan
-func (c ContainerPipe[_, T]) InChan() chan<- T {
+func (c *ContainerPipe[_, T]) InChan() chan<- T {
 	return c.inchan
 }
 
 // DelChan
-func (c ContainerPipe[K, _]) DelChan() chan<- K {
+func (c *ContainerPipe[K, _]) DelChan() chan<- K {
 	return c.delchan
 }
 
 // OutChan
-func (c ContainerPipe[_, T]) OutChan() <-chan T {
+func (c *ContainerPipe[_, T]) OutChan() <-chan T {
 	return c.outchan
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
-func (c ContainerPipe[_, T]) PipelineChan() chan T {
+func (c *ContainerPipe[_, T]) PipelineChan() chan T {
 	return c.outchan
 }
 
@@ -125,45 +131,94 @@ func (c *ContainerPipe[_, _]) Close() {
 	c.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (c *ContainerPipe[_, _]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (c *ContainerPipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, c.pl, c.drain, c.done, c.can, c.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (c *ContainerPipe[_, _]) SetMetrics(name string, m Metrics) {
+	c.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (c *ContainerPipe[_, _]) Stats() Stats {
+	return c.metrics.stats(c.done, len(c.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (c *ContainerPipe[_, _]) Upstreams() []any {
+	return upstreams(c.pl)
+}
+
 // mainloop
 // If the container is empty, only listen for
 func (c *ContainerPipe[_, T]) mainloop() {
+	defer close(c.done)
 	defer c.wg.Done()
 	defer close(c.outchan)
 	defer recoverFromClosedChan()
 
+	in := c.inchan
+	stop := c.drain.ch
 	for {
 		// Check if we have one ready to send
 		if c.onetosend == nil {
 			c.onetosend = c.pop() // pop will return nil if one is not ready
 		}
 
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && c.onetosend == nil && (in == nil || len(in) == 0) {
+			return
+		}
+
 		if c.onetosend == nil {
 			// Save the current size
 			atomic.StoreInt32(&c.approxSize, int32(len(c.tmap)))
+			c.metrics.depth(len(c.tmap))
+			c.metrics.receiving()
 			// None to send so don't select on output channel
 			select {
-			case t := <-c.inchan:
-
+			case t, ok := <-in:
+				if !ok {
+					in, stop = nil, nil
+					break
+				}
 				c.addT(t)
 			case k := <-c.delchan:
 				c.delK(k)
+			case <-stop:
+				stop = nil
 			case <-c.ctx.Done():
 				return
 			}
 		} else {
 			// Save the current size
 			atomic.StoreInt32(&c.approxSize, int32(len(c.tmap))+1)
+			c.metrics.depth(len(c.tmap) + 1)
+			c.metrics.sending()
 
 			// We have one to send so select on output channel
 			select {
 			case c.outchan <- *c.onetosend:
 				// Now that we sent it, clean onetosend so we get the next one
 				c.onetosend = nil
-			case t := <-c.inchan:
+				c.metrics.out()
+			case t, ok := <-in:
+				if !ok {
+					in, stop = nil, nil
+					break
+				}
 				c.addT(t)
 			case k := <-c.delchan:
 				c.delK(k)
+			case <-stop:
+				stop = nil
 			case <-c.ctx.Done():
 				return
 			}
@@ -171,8 +226,12 @@ func (c *ContainerPipe[_, T]) mainloop() {
 	}
 }
 
-func (ContainerPipe[K, T]) NewWithChan(in chan T) *ContainerPipe[K, T] {
-	con, cancel := context.WithCancel(context.Background())
+func (c ContainerPipe[K, T]) NewWithChan(in chan T) *ContainerPipe[K, T] {
+	return c.NewWithContext(context.Background(), in)
+}
+
+func (ContainerPipe[K, T]) NewWithContext(ctx context.Context, in chan T) *ContainerPipe[K, T] {
+	con, cancel := context.WithCancel(ctx)
 	r := ContainerPipe[K, T]{
 		tmap:    make(map[K]T),
 		tlist:   list.New(),
@@ -180,6 +239,9 @@ func (ContainerPipe[K, T]) NewWithChan(in chan T) *ContainerPipe[K, T] {
 		outchan: make(chan T, CHANSIZE),
 		delchan: make(chan K, CHANSIZE),
 		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
 		ctx:     con,
 		can:     cancel}
 
@@ -189,7 +251,11 @@ func (ContainerPipe[K, T]) NewWithChan(in chan T) *ContainerPipe[K, T] {
 }
 
 func (c ContainerPipe[K, T]) NewWithPipeline(p Pipeline[T]) *ContainerPipe[K, T] {
-	r := c.NewWithChan(p.PipelineChan())
+	return c.NewWithPipelineContext(context.Background(), p)
+}
+
+func (c ContainerPipe[K, T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T]) *ContainerPipe[K, T] {
+	r := c.NewWithContext(ctx, p.PipelineChan())
 
 	// save pipeline
 	r.pl = p
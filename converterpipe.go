@@ -2,9 +2,25 @@ package pipelines
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// ConvertError holds an input that failed to convert and the reason why
+type ConvertError[I any] struct {
+	Input I
+	Err   error
+}
+
+func (e ConvertError[_]) Error() string {
+	return fmt.Sprintf("convert failed for %v: %v", e.Input, e.Err)
+}
+
+func (e ConvertError[_]) Unwrap() error {
+	return e.Err
+}
+
 type ConverterPipe[I any, O any] struct {
 	ctx context.Context
 	can context.CancelFunc
@@ -12,10 +28,22 @@ type ConverterPipe[I any, O any] struct {
 	inchan  chan I
 	outchan chan O
 
+	// errors are only sent once someone asks for them
+	errs   *BranchPipe[ConvertError[I]]
+	errson int32
+
 	convert func(I) (O, error)
 
-	pl Pipeline[I]
-	wg *sync.WaitGroup
+	// workers is the number of convert go routines, ordered keeps the output
+	// in the same order as the input when there is more than one
+	workers int
+	ordered bool
+
+	pl      Pipeline[I]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // InChan
@@ -33,6 +61,40 @@ func (c ConverterPipe[_, O]) PipelineChan() chan O {
 	return c.outchan
 }
 
+// ErrChan returns a channel with every input that failed to convert.
+// Once this is called failures must be read or the pipe will block.
+func (c *ConverterPipe[I, _]) ErrChan() <-chan ConvertError[I] {
+	atomic.StoreInt32(&c.errson, 1)
+	return c.errs.OutChan()
+}
+
+// ErrPipeline returns the failures as a Pipeline so a dead letter chain can be added,
+// closing it stops the failures being sent
+func (c *ConverterPipe[I, _]) ErrPipeline() *BranchPipe[ConvertError[I]] {
+	atomic.StoreInt32(&c.errson, 1)
+	return c.errs
+}
+
+// closeBranch is called when the error pipeline is closed
+func (c *ConverterPipe[I, _]) closeBranch(*BranchPipe[ConvertError[I]]) {
+	atomic.StoreInt32(&c.errson, 0)
+}
+
+// drainBranch is called when the error pipeline is drained, it is the same as closing it
+func (c *ConverterPipe[I, _]) drainBranch(context.Context, *BranchPipe[ConvertError[I]]) error {
+	atomic.StoreInt32(&c.errson, 0)
+	return nil
+}
+
+// fail sends the input and error to the error channel if anyone is listening
+func (c *ConverterPipe[I, _]) fail(t I, err error) {
+	c.metrics.error(err)
+	if atomic.LoadInt32(&c.errson) == 0 {
+		return
+	}
+	c.errs.send(ConvertError[I]{Input: t, Err: err}, true)
+}
+
 // Close
 func (c *ConverterPipe[_, _]) Close() {
 	// If we pipelined then call Close the input pipeline
@@ -47,57 +109,307 @@ func (c *ConverterPipe[_, _]) Close() {
 	c.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (c ConverterPipe[_, _]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (c *ConverterPipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, c.pl, c.drain, c.done, c.can, c.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (c *ConverterPipe[_, _]) SetMetrics(name string, m Metrics) {
+	c.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (c *ConverterPipe[_, _]) Stats() Stats {
+	return c.metrics.stats(c.done, len(c.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (c *ConverterPipe[_, _]) Upstreams() []any {
+	return upstreams(c.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely
 // exit when our context is closed
 func (c *ConverterPipe[I, O]) mainloop() {
+	defer close(c.done)
 	defer c.wg.Done()
 	defer close(c.outchan)
+	defer close(c.errs.outchan)
 
+	stop := c.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(c.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-c.inchan:
 			if !ok {
 				return
 			}
+			c.metrics.in()
+			start := c.metrics.start()
 			v, err := c.convert(t)
+			c.metrics.latency(start)
 			if err != nil {
+				c.fail(t, err)
 				break
 			}
+			c.metrics.sending()
 			select {
 			case c.outchan <- v:
+				c.metrics.out()
+			case <-c.ctx.Done():
+				return
+			}
+		case <-stop:
+			stop = nil
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// convertResult holds the output of one convert call
+type convertResult[I any, O any] struct {
+	in  I
+	v   O
+	err error
+}
+
+// convertJob is an item waiting for a worker, the result is written to res
+type convertJob[I any, O any] struct {
+	in  I
+	res chan convertResult[I, O]
+}
+
+// send writes v to the out channel, returns false if our context is closed
+func (c *ConverterPipe[_, O]) send(v O) bool {
+	c.metrics.sending()
+	select {
+	case c.outchan <- v:
+		c.metrics.out()
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// unorderedworker, same as mainloop but many of these share the in channel
+// and output as soon as a convert is finished
+func (c *ConverterPipe[I, O]) unorderedworker(wwg *sync.WaitGroup) {
+	defer wwg.Done()
+
+	stop := c.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(c.inchan) == 0 {
+			return
+		}
+
+		select {
+		case t, ok := <-c.inchan:
+			if !ok {
+				return
+			}
+			c.metrics.in()
+			start := c.metrics.start()
+			v, err := c.convert(t)
+			c.metrics.latency(start)
+			if err != nil {
+				c.fail(t, err)
+				break
+			}
+			if !c.send(v) {
+				return
+			}
+		case <-stop:
+			stop = nil
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// orderedworker runs the convert for jobs until the jobs channel is closed
+func (c *ConverterPipe[I, O]) orderedworker(wwg *sync.WaitGroup, jobs chan convertJob[I, O]) {
+	defer wwg.Done()
+
+	for j := range jobs {
+		start := c.metrics.start()
+		v, err := c.convert(j.in)
+		c.metrics.latency(start)
+		j.res <- convertResult[I, O]{in: j.in, v: v, err: err}
+	}
+}
+
+// collect waits on the results in the order the jobs were handed out and writes them out
+func (c *ConverterPipe[I, O]) collect(wwg *sync.WaitGroup, pending chan chan convertResult[I, O]) {
+	defer wwg.Done()
+
+	for res := range pending {
+		select {
+		case r := <-res:
+			if r.err != nil {
+				c.fail(r.in, r.err)
+				break
+			}
+			if !c.send(r.v) {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatch reads the in channel and hands items to the workers, the result
+// channel is queued to the collector in input order
+func (c *ConverterPipe[I, O]) dispatch(jobs chan convertJob[I, O], pending chan chan convertResult[I, O]) {
+	defer close(jobs)
+	defer close(pending)
+
+	stop := c.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(c.inchan) == 0 {
+			return
+		}
+
+		select {
+		case t, ok := <-c.inchan:
+			if !ok {
+				return
+			}
+			c.metrics.in()
+			res := make(chan convertResult[I, O], 1)
+			select {
+			case pending <- res:
+			case <-c.ctx.Done():
+				return
+			}
+			select {
+			case jobs <- convertJob[I, O]{in: t, res: res}:
 			case <-c.ctx.Done():
 				return
 			}
+		case <-stop:
+			stop = nil
 		case <-c.ctx.Done():
 			return
 		}
 	}
 }
 
-func (ConverterPipe[I, O]) NewWithChannel(in chan I, fun func(I) (O, error)) *ConverterPipe[I, O] {
-	con, cancel := context.WithCancel(context.Background())
+// parallelloop runs the workers and closes the out channel when they are all done
+func (c *ConverterPipe[I, O]) parallelloop() {
+	defer close(c.done)
+	defer c.wg.Done()
+	defer close(c.outchan)
+	defer close(c.errs.outchan)
+
+	wwg := new(sync.WaitGroup)
+
+	if !c.ordered {
+		for i := 0; i < c.workers; i++ {
+			wwg.Add(1)
+			go c.unorderedworker(wwg)
+		}
+		wwg.Wait()
+		return
+	}
+
+	jobs := make(chan convertJob[I, O])
+	pending := make(chan chan convertResult[I, O], c.workers)
+	for i := 0; i < c.workers; i++ {
+		wwg.Add(1)
+		go c.orderedworker(wwg, jobs)
+	}
+	wwg.Add(1)
+	go c.collect(wwg, pending)
+
+	c.dispatch(jobs, pending)
+	wwg.Wait()
+}
+
+func (c ConverterPipe[I, O]) NewWithChannel(in chan I, fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewParallelWithContext(context.Background(), 1, false, in, fun)
+}
+
+func (c ConverterPipe[I, O]) NewWithContext(ctx context.Context, in chan I, fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewParallelWithContext(ctx, 1, false, in, fun)
+}
+
+func (c ConverterPipe[I, O]) NewWithPipeline(p Pipeline[I], fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewWithPipelineContext(context.Background(), p, fun)
+}
+
+func (c ConverterPipe[I, O]) NewWithPipelineContext(ctx context.Context, p Pipeline[I], fun func(I) (O, error)) *ConverterPipe[I, O] {
+	r := c.NewWithContext(ctx, p.PipelineChan(), fun)
+	r.pl = p
+
+	return r
+}
+
+func (c ConverterPipe[I, O]) New(fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewWithChannel(make(chan I, CHANSIZE), fun)
+}
+
+// NewParallelWithChannel runs fun on workers go routines, if ordered is true the output
+// is in the same order as the input, otherwise items are output as soon as they are converted
+func (c ConverterPipe[I, O]) NewParallelWithChannel(workers int, ordered bool, in chan I, fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewParallelWithContext(context.Background(), workers, ordered, in, fun)
+}
+
+func (ConverterPipe[I, O]) NewParallelWithContext(ctx context.Context, workers int, ordered bool, in chan I, fun func(I) (O, error)) *ConverterPipe[I, O] {
+	if workers < 1 {
+		workers = 1
+	}
+
+	con, cancel := context.WithCancel(ctx)
 
 	r := ConverterPipe[I, O]{
 		ctx:     con,
 		can:     cancel,
 		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
 		convert: fun,
+		workers: workers,
+		ordered: ordered,
 		inchan:  in,
 		outchan: make(chan O, CHANSIZE)}
+	r.errs = newBranch[ConvertError[I]](con, &r, CHANSIZE)
 
 	r.wg.Add(1)
-	go r.mainloop()
+	if workers == 1 {
+		go r.mainloop()
+	} else {
+		go r.parallelloop()
+	}
 
 	return &r
 }
 
-func (c ConverterPipe[I, O]) NewWithPipeline(p Pipeline[I], fun func(I) (O, error)) *ConverterPipe[I, O] {
-	r := c.NewWithChannel(p.PipelineChan(), fun)
+func (c ConverterPipe[I, O]) NewParallelWithPipeline(workers int, ordered bool, p Pipeline[I], fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewParallelWithPipelineContext(context.Background(), workers, ordered, p, fun)
+}
+
+func (c ConverterPipe[I, O]) NewParallelWithPipelineContext(ctx context.Context, workers int, ordered bool, p Pipeline[I], fun func(I) (O, error)) *ConverterPipe[I, O] {
+	r := c.NewParallelWithContext(ctx, workers, ordered, p.PipelineChan(), fun)
 	r.pl = p
 
 	return r
 }
 
-func (c ConverterPipe[I, O]) New(fun func(I) (O, error)) *ConverterPipe[I, O] {
-	return c.NewWithChannel(make(chan I, CHANSIZE), fun)
+func (c ConverterPipe[I, O]) NewParallel(workers int, ordered bool, fun func(I) (O, error)) *ConverterPipe[I, O] {
+	return c.NewParallelWithChannel(workers, ordered, make(chan I, CHANSIZE), fun)
 }
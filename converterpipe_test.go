@@ -1,9 +1,11 @@
 package pipelines_test
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/sterlingdevils/pipelines"
 )
@@ -54,3 +56,91 @@ func ExampleConverterPipe_fixedoutput() {
 	// Output:
 	// Hello
 }
+
+func ExampleConverterPipe_NewParallel() {
+	cvt := pipelines.ConverterPipe[int, int]{}.NewParallel(4, true,
+		func(i int) (int, error) {
+			// Make the early ones slow so they finish last
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			return i * i, nil
+		})
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			cvt.InChan() <- i
+		}
+		close(cvt.InChan())
+	}()
+
+	for o := range cvt.OutChan() {
+		fmt.Print(o, " ")
+	}
+	fmt.Println()
+
+	cvt.Close()
+	// Output:
+	// 0 1 4 9 16 25 36 49 64 81
+}
+
+func ExampleConverterPipe_NewParallel_unordered() {
+	cvt := pipelines.ConverterPipe[int, int]{}.NewParallel(4, false,
+		func(i int) (int, error) {
+			if i%2 == 1 {
+				return 0, errors.New("odd")
+			}
+			return i, nil
+		})
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			cvt.InChan() <- i
+		}
+		close(cvt.InChan())
+	}()
+
+	sum := 0
+	for o := range cvt.OutChan() {
+		sum += o
+	}
+	fmt.Println(sum)
+
+	cvt.Close()
+	// Output:
+	// 20
+}
+
+func ExampleConverterPipe_ErrChan() {
+	cvt := pipelines.ConverterPipe[string, int]{}.New(strconv.Atoi)
+	errs := cvt.ErrChan()
+
+	go func() {
+		cvt.InChan() <- "12"
+		cvt.InChan() <- "twelve"
+	}()
+
+	fmt.Println(<-cvt.OutChan())
+	e := <-errs
+	fmt.Println(e.Input, errors.Is(e, strconv.ErrSyntax))
+
+	cvt.Close()
+	// Output:
+	// 12
+	// twelve true
+}
+
+// Failures can be chained to a dead letter pipeline
+func ExampleConverterPipe_ErrPipeline() {
+	cvt := pipelines.ConverterPipe[string, int]{}.New(strconv.Atoi)
+	dead := pipelines.ConverterPipe[pipelines.ConvertError[string], string]{}.NewWithPipeline(cvt.ErrPipeline(),
+		func(e pipelines.ConvertError[string]) (string, error) {
+			return "dead letter: " + e.Input, nil
+		})
+
+	cvt.InChan() <- "x"
+	fmt.Println(<-dead.OutChan())
+
+	dead.Close()
+	cvt.Close()
+	// Output:
+	// dead letter: x
+}
@@ -0,0 +1,354 @@
+package pipelines
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DelayPipe holds each item until its release time, then sends them in the order they
+// come due.  Items that are a Deadliner are released at their Deadline, the rest are
+// held for delay.  An item can be taken out before it is sent by passing its key to
+// DelChan.  An item with the same key as one we hold takes its place with a new release
+// time, the same as re-adding a key to a ContainerPipe, the old one counts as dropped.
+type DelayPipe[K comparable, T Keyer[K]] struct {
+	// Clock is used for the release times, nil is RealClock
+	Clock Clock
+
+	delay time.Duration
+
+	// pending is a pointer so the value receivers don't copy it while we update it
+	pending *int64
+
+	inchan  chan T
+	outchan chan T
+	delchan chan K
+
+	ctx context.Context
+	can context.CancelFunc
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// delayed is an item waiting in the heap, index is its place in the heap or -1 once it is due
+type delayed[T any] struct {
+	t     T
+	due   time.Time
+	seq   uint64
+	index int
+}
+
+// delayHeap has the item that comes due first at the front, seq keeps equal times in order
+type delayHeap[T any] []*delayed[T]
+
+func (h delayHeap[T]) Len() int { return len(h) }
+
+func (h delayHeap[T]) Less(i, j int) bool {
+	if !h[i].due.Equal(h[j].due) {
+		return h[i].due.Before(h[j].due)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h delayHeap[T]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap[T]) Push(x any) {
+	d := x.(*delayed[T])
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *delayHeap[T]) Pop() any {
+	old := *h
+	n := len(old) - 1
+	d := old[n]
+	old[n] = nil
+	d.index = -1
+	*h = old[:n]
+	return d
+}
+
+// next returns the time the front item is due, ok is false if we are empty
+func (h delayHeap[T]) next() (due time.Time, ok bool) {
+	if len(h) == 0 {
+		return due, false
+	}
+	return h[0].due, true
+}
+
+// popDue moves the items that are due at now to the end of ready
+func (h *delayHeap[T]) popDue(now time.Time, ready []*delayed[T]) []*delayed[T] {
+	for h.Len() > 0 && !(*h)[0].due.After(now) {
+		ready = append(ready, heap.Pop(h).(*delayed[T]))
+	}
+	return ready
+}
+
+// removeDelayed takes it out of the ready queue
+func removeDelayed[T any](ready []*delayed[T], it *delayed[T]) []*delayed[T] {
+	for i := range ready {
+		if ready[i] == it {
+			return append(ready[:i], ready[i+1:]...)
+		}
+	}
+	return ready
+}
+
+// dueTimer keeps one Timer set for the item at the front of a delayHeap
+type dueTimer struct {
+	clock Clock
+	timer Timer
+	due   time.Time
+
+	// C fires when the front item is due, it is nil when nothing is waiting
+	C <-chan time.Time
+}
+
+// set moves the timer to due, or stops it if ok is false
+func (t *dueTimer) set(due time.Time, ok bool) {
+	if !ok {
+		t.stop()
+		return
+	}
+	if t.timer != nil && t.due.Equal(due) {
+		return
+	}
+	t.stop()
+	t.due = due
+	t.timer = t.clock.NewTimer(due.Sub(t.clock.Now()))
+	t.C = t.timer.C()
+}
+
+// fired is called after reading from C, set starts a new timer
+func (t *dueTimer) fired() {
+	t.timer, t.C = nil, nil
+}
+
+func (t *dueTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.timer, t.C = nil, nil
+}
+
+// InChan
+func (d DelayPipe[_, T]) InChan() chan<- T {
+	return d.inchan
+}
+
+// DelChan takes the key of an item to take out before it is sent
+func (d DelayPipe[K, _]) DelChan() chan<- K {
+	return d.delchan
+}
+
+// OutChan
+func (d DelayPipe[_, T]) OutChan() <-chan T {
+	return d.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (d DelayPipe[_, T]) PipelineChan() chan T {
+	return d.outchan
+}
+
+// Close
+func (d *DelayPipe[_, _]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if d.pl != nil {
+		d.pl.Close()
+	}
+
+	// Cancel our context
+	d.can()
+
+	// Wait for us to be done
+	d.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (d DelayPipe[_, _]) Done() <-chan struct{} {
+	return d.done
+}
+
+// Drain lets the items we hold flow out as they come due before we shut down, see Drainer
+func (d *DelayPipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, d.pl, d.drain, d.done, d.can, d.wg)
+}
+
+// Pending returns the number of items we hold, waiting or due and not yet sent
+func (d *DelayPipe[_, _]) Pending() int {
+	return int(atomic.LoadInt64(d.pending))
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (d *DelayPipe[_, _]) SetMetrics(name string, m Metrics) {
+	d.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (d *DelayPipe[_, _]) Stats() Stats {
+	return d.metrics.stats(d.done, len(d.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (d *DelayPipe[_, _]) Upstreams() []any {
+	return upstreams(d.pl)
+}
+
+// releaseTime is the item's Deadline if it has one, else delay from now
+func (d *DelayPipe[_, T]) releaseTime(t T) time.Time {
+	if dl, ok := any(t).(Deadliner); ok {
+		return dl.Deadline()
+	}
+	return d.Clock.Now().Add(d.delay)
+}
+
+// mainloop, read from in channel and hold the items in a heap by release time, move
+// them to the ready queue as they come due and write them to the out channel.  On
+// input close we send what we hold as it comes due, exit when our context is closed
+func (d *DelayPipe[K, T]) mainloop() {
+	defer close(d.done)
+	defer d.wg.Done()
+	defer close(d.outchan)
+
+	var waiting delayHeap[T]
+	var ready []*delayed[T]
+	keys := make(map[K]*delayed[T])
+	var seq uint64
+
+	timer := dueTimer{clock: d.Clock}
+	defer timer.stop()
+
+	in := d.inchan
+	stop := d.drain.ch
+	for {
+		// Move the items that are due to the ready queue
+		ready = waiting.popDue(d.Clock.Now(), ready)
+
+		// Keep the timer set for the next one to come due
+		timer.set(waiting.next())
+
+		held := len(keys)
+		atomic.StoreInt64(d.pending, int64(held))
+		d.metrics.depth(held)
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && held == 0 {
+			return
+		}
+
+		// Only select on the output when we have something due
+		var out chan T
+		var head T
+		if len(ready) > 0 {
+			out, head = d.outchan, ready[0].t
+			d.metrics.sending()
+		} else {
+			d.metrics.receiving()
+		}
+
+		select {
+		case out <- head:
+			delete(keys, head.Key())
+			ready = popFront(ready)
+			d.metrics.out()
+		case t, ok := <-in:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			d.metrics.in()
+
+			k := t.Key()
+			it, ok := keys[k]
+			if !ok {
+				it = &delayed[T]{t: t, due: d.releaseTime(t), seq: seq}
+				seq++
+				keys[k] = it
+				heap.Push(&waiting, it)
+				break
+			}
+
+			// Replace the one we hold and wait for the new release time, if it was
+			// already due take it off the ready queue and put it back in the heap
+			it.t, it.due, it.seq = t, d.releaseTime(t), seq
+			seq++
+			if it.index >= 0 {
+				heap.Fix(&waiting, it.index)
+			} else {
+				ready = removeDelayed(ready, it)
+				heap.Push(&waiting, it)
+			}
+			d.metrics.dropped(1)
+		case k := <-d.delchan:
+			it, ok := keys[k]
+			if !ok {
+				break
+			}
+			delete(keys, k)
+			if it.index >= 0 {
+				heap.Remove(&waiting, it.index)
+				break
+			}
+			ready = removeDelayed(ready, it)
+		case <-timer.C:
+			timer.fired()
+		case <-stop:
+			stop = nil
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d DelayPipe[K, T]) NewWithChannel(delay time.Duration, in chan T) *DelayPipe[K, T] {
+	return d.NewWithContext(context.Background(), delay, in)
+}
+
+func (d DelayPipe[K, T]) NewWithContext(ctx context.Context, delay time.Duration, in chan T) *DelayPipe[K, T] {
+	con, cancel := context.WithCancel(ctx)
+
+	r := DelayPipe[K, T]{
+		Clock:   orRealClock(d.Clock),
+		delay:   delay,
+		pending: new(int64),
+		inchan:  in,
+		outchan: make(chan T, CHANSIZE),
+		delchan: make(chan K, CHANSIZE),
+		ctx:     con,
+		can:     cancel,
+		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: newStageMetrics(d.Clock)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r
+}
+
+func (d DelayPipe[K, T]) NewWithPipeline(delay time.Duration, p Pipeline[T]) *DelayPipe[K, T] {
+	return d.NewWithPipelineContext(context.Background(), delay, p)
+}
+
+func (d DelayPipe[K, T]) NewWithPipelineContext(ctx context.Context, delay time.Duration, p Pipeline[T]) *DelayPipe[K, T] {
+	r := d.NewWithContext(ctx, delay, p.PipelineChan())
+	r.pl = p
+
+	return r
+}
+
+func (d DelayPipe[K, T]) New(delay time.Duration) *DelayPipe[K, T] {
+	return d.NewWithChannel(delay, make(chan T, CHANSIZE))
+}
@@ -0,0 +1,102 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+type retry struct {
+	ID int
+	At time.Time
+}
+
+func (r retry) Key() int {
+	return r.ID
+}
+
+func (r retry) Deadline() time.Time {
+	return r.At
+}
+
+// Items come out in the order they are due, the one we take out never does
+func ExampleDelayPipe() {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := pipelines.NewFakeClock(start)
+	d := pipelines.DelayPipe[int, retry]{Clock: clock}.New(time.Second)
+
+	d.InChan() <- retry{ID: 1, At: start.Add(3 * time.Second)}
+	d.InChan() <- retry{ID: 2, At: start.Add(1 * time.Second)}
+	d.InChan() <- retry{ID: 3, At: start.Add(2 * time.Second)}
+	d.DelChan() <- 3
+	for d.Pending() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(5 * time.Second)
+	fmt.Println((<-d.OutChan()).ID, (<-d.OutChan()).ID)
+
+	d.Close()
+	// Output:
+	// 2 1
+}
+
+// Items that are not a Deadliner are held for the fixed delay
+func ExampleDelayPipe_delay() {
+	clock := pipelines.NewFakeClock(time.Time{})
+	d := pipelines.DelayPipe[int, node2]{Clock: clock}.New(10 * time.Second)
+
+	d.InChan() <- node2{key: 1}
+	clock.BlockUntil(1)
+
+	clock.Advance(9 * time.Second)
+	select {
+	case n := <-d.OutChan():
+		fmt.Println("early", n.Key())
+	case <-time.After(10 * time.Millisecond):
+		fmt.Println("waiting")
+	}
+
+	clock.Advance(time.Second)
+	fmt.Println((<-d.OutChan()).Key())
+
+	d.Close()
+	// Output:
+	// waiting
+	// 1
+}
+
+// An item for a key we hold takes its place and is sent at its own release time
+func ExampleDelayPipe_replace() {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := pipelines.NewFakeClock(start)
+	d := pipelines.DelayPipe[int, retry]{Clock: clock}.New(time.Second)
+
+	d.InChan() <- retry{ID: 1, At: start.Add(3 * time.Second)}
+	d.InChan() <- retry{ID: 2, At: start.Add(2 * time.Second)}
+	d.InChan() <- retry{ID: 1, At: start.Add(1 * time.Second)}
+	for d.Stats().Dropped != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		r := <-d.OutChan()
+		fmt.Println(r.ID, r.At.Sub(start))
+	}
+
+	d.Close()
+	// Output:
+	// 1 1s
+	// 2 2s
+}
+
+func TestDelayPipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) node2 { return node2{key: i} },
+		func(in pipelines.Pipeline[node2]) pipelines.Pipeline[node2] {
+			return pipelines.DelayPipe[int, node2]{}.NewWithPipeline(time.Millisecond, in)
+		})
+}
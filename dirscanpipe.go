@@ -15,12 +15,18 @@ type DirScan struct {
 	Dir      string
 	ScanTime time.Duration
 
+	// Clock is used to wait between scans, nil is RealClock
+	Clock Clock
+
 	outchan chan string
 
 	ctx context.Context
 	can context.CancelFunc
 
-	wg *sync.WaitGroup
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // scanDir
@@ -42,8 +48,12 @@ func (d DirScan) scanDir() error {
 	for _, f := range entries {
 		// if it is not a directory and is not .prefixed
 		if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+			d.metrics.sending()
 			select {
 			case d.outchan <- filepath.Join(path, f.Name()):
+				d.metrics.out()
+			case <-d.drain.ch:
+				return nil
 			case <-d.ctx.Done():
 				return nil
 			}
@@ -54,13 +64,18 @@ func (d DirScan) scanDir() error {
 
 // loop until we receive a stop on the run channel
 func (d *DirScan) mainloop() {
+	defer close(d.done)
 	defer d.wg.Done()
 	defer close(d.outchan)
 
 	for {
-		d.scanDir()
+		if err := d.scanDir(); err != nil {
+			d.metrics.error(err)
+		}
 		select {
-		case <-time.After(d.ScanTime):
+		case <-d.Clock.After(d.ScanTime):
+		case <-d.drain.ch:
+			return
 		case <-d.ctx.Done():
 			return
 		}
@@ -86,10 +101,40 @@ func (d *DirScan) Close() {
 	d.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (d DirScan) Done() <-chan struct{} {
+	return d.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (d *DirScan) Drain(ctx context.Context) error {
+	return drainPipe[string](ctx, nil, d.drain, d.done, d.can, d.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (d *DirScan) SetMetrics(name string, m Metrics) {
+	d.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (d *DirScan) Stats() Stats {
+	return d.metrics.stats(d.done, 0)
+}
+
+// Upstreams returns nil as we are a source
+func (d *DirScan) Upstreams() []any {
+	return nil
+}
+
 // New creates a new dir scanner and starts a scanning loop to send filenames to a channel
 // Must pass a WaitGroup it as we create a go routine for the scanner
 // As a writter we assume we own the channel we return, we will close it when our Close() is called
-func (DirScan) New(dir string, scantime time.Duration, chanSize int) (*DirScan, error) {
+func (d DirScan) New(dir string, scantime time.Duration, chanSize int) (*DirScan, error) {
+	return d.NewWithContext(context.Background(), dir, scantime, chanSize)
+}
+
+// NewWithContext is the same as New but cancelling ctx will stop the scanner
+func (d DirScan) NewWithContext(parent context.Context, dir string, scantime time.Duration, chanSize int) (*DirScan, error) {
 	if fileInfo, err := os.Stat(dir); err != nil {
 		return nil, errors.New("name not found: " + dir)
 	} else {
@@ -98,11 +143,11 @@ func (DirScan) New(dir string, scantime time.Duration, chanSize int) (*DirScan,
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	d := DirScan{Dir: dir, outchan: make(chan string, chanSize), ScanTime: scantime, ctx: ctx, can: cancel, wg: new(sync.WaitGroup)}
+	ctx, cancel := context.WithCancel(parent)
+	r := DirScan{Dir: dir, outchan: make(chan string, chanSize), ScanTime: scantime, Clock: orRealClock(d.Clock), ctx: ctx, can: cancel, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), metrics: newStageMetrics(d.Clock)}
 
-	d.wg.Add(1)
-	go d.mainloop()
+	r.wg.Add(1)
+	go r.mainloop()
 
-	return &d, nil
+	return &r, nil
 }
@@ -0,0 +1,78 @@
+package pipelines
+
+import (
+	"context"
+	"sync"
+)
+
+// Drainer is a pipe that can shut down gracefully.  Drain is called on the tail of a chain,
+// it drains the input pipeline first, then lets everything the pipe holds flow out before
+// it shuts down.  If ctx finishes first it falls back to a hard cancel like Close.
+//
+// Drain is only lossless for a pipe made with NewWithPipeline or NewWithPipelineContext,
+// its input pipeline is drained and closed before the pipe is told to finish.  A pipe made
+// with New or NewWithChannel can't know when its producer is done, it only waits for the items
+// already buffered on the input channel, and with CHANSIZE 0 there are none.  The
+// caller must have stopped writing to the input channel, or closed it, before calling
+// Drain, an item sent after that may be lost.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// signal is a channel that is closed once, used to tell a mainloop to drain
+type signal struct {
+	ch   chan struct{}
+	once *sync.Once
+}
+
+func newSignal() signal {
+	return signal{ch: make(chan struct{}), once: new(sync.Once)}
+}
+
+// fire closes the channel, it is safe to call more than once
+func (s signal) fire() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// fired returns true once the channel is closed
+func (s signal) fired() bool {
+	select {
+	case <-s.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// drainInput drains the input pipeline if it can, otherwise it is closed
+func drainInput[T any](ctx context.Context, pl Pipeline[T]) error {
+	if pl == nil {
+		return nil
+	}
+
+	if d, ok := pl.(Drainer); ok {
+		return d.Drain(ctx)
+	}
+
+	pl.Close()
+	return nil
+}
+
+// drainPipe is the common Drain for a pipe.  The input is drained, then the mainloop
+// is told to finish what it holds and we wait for it.  If ctx finishes first we cancel.
+// When pl is nil the mainloop stops once its input channel is empty, see Drainer
+func drainPipe[T any](ctx context.Context, pl Pipeline[T], stop signal, done <-chan struct{}, can context.CancelFunc, wg *sync.WaitGroup) error {
+	err := drainInput(ctx, pl)
+	stop.fire()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	can()
+	wg.Wait()
+
+	return err
+}
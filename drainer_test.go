@@ -0,0 +1,75 @@
+package pipelines_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+// Drain the tail of a chain, everything already in the chain reaches the end
+func ExampleDrainer() {
+	buf, _ := pipelines.BufferPipe[int]{}.New(10)
+	con := pipelines.ContainerPipe[int, node2]{}.NewWithPipeline(
+		pipelines.ConverterPipe[int, node2]{}.NewWithPipeline(buf,
+			func(i int) (node2, error) { return node2{key: i}, nil }))
+
+	for i := 0; i < 5; i++ {
+		buf.InChan() <- i
+	}
+
+	res := make(chan int)
+	go func() {
+		sum := 0
+		for n := range con.OutChan() {
+			sum += n.key
+		}
+		res <- sum
+	}()
+
+	err := con.Drain(context.Background())
+	fmt.Println(err, <-res)
+	// Output:
+	// <nil> 10
+}
+
+// If the deadline passes the pipe is closed without waiting
+func ExampleDrainer_deadline() {
+	in := make(chan int, 1)
+	throt := pipelines.ThrottlePipe[int]{}.NewWithChannel(in)
+
+	// No tokens so this is stuck
+	in <- 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := throt.Drain(ctx)
+	fmt.Println(errors.Is(err, context.DeadlineExceeded))
+	// Output:
+	// true
+}
+
+// Draining a branch waits for the other branches before the tee is drained
+func ExampleBranchPipe_Drain() {
+	tee, _ := pipelines.TeePipe[int]{}.New(
+		pipelines.TeeConfig{Policy: pipelines.TEEBUFFER, Size: 5},
+		pipelines.TeeConfig{Policy: pipelines.TEEBUFFER, Size: 5})
+	a := pipelines.NullConsumePipe[int]{}.NewWithPipeline(tee.Branch(0))
+	b := pipelines.BatchPipe[int]{}
+	batch, _ := b.NewWithPipeline(10, 0, 0, tee.Branch(1))
+
+	for i := 0; i < 3; i++ {
+		tee.InChan() <- i
+	}
+
+	go a.Drain(context.Background())
+	go batch.Drain(context.Background())
+
+	fmt.Println(<-batch.OutChan())
+	<-a.Done()
+	// Output:
+	// [0 1 2]
+}
@@ -19,12 +19,21 @@ type FileDump struct {
 	inchan  chan Dataer
 	Outchan *chan string
 
-	pl Pipeline[Dataer]
-	wg *sync.WaitGroup
-
+	pl      Pipeline[Dataer]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+
+	// Metricfunc is sent "filecount" after each file we write, set it on the receiver of New.
+	//
+	// Deprecated: use SetMetrics
 	Metricfunc func(name string, val int)
 }
 
+// SetMetric sends name and val to Metricfunc if there is one
+//
+// Deprecated: use SetMetrics
 func (b FileDump) SetMetric(name string, val int) {
 	if b.Metricfunc == nil {
 		return
@@ -52,6 +61,31 @@ func (b *FileDump) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b FileDump) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *FileDump) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *FileDump) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *FileDump) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *FileDump) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 func (b *FileDump) writefile(t Dataer) (string, error) {
 	name := strconv.FormatInt(time.Now().Unix(), 10) + "." + fmt.Sprintf("%06d", b.received)
 	tmpName := "." + name
@@ -76,10 +110,15 @@ func (b *FileDump) writefile(t Dataer) (string, error) {
 
 // Write to a file and put the name on the output buffer
 func (b *FileDump) writeandRespond(t Dataer) {
+	b.metrics.in()
+	start := b.metrics.start()
 	f, err := b.writefile(t)
+	b.metrics.latency(start)
 	if err != nil {
+		b.metrics.error(err)
 		return
 	}
+	b.metrics.out()
 
 	if b.Outchan == nil {
 		return
@@ -94,24 +133,37 @@ func (b *FileDump) writeandRespond(t Dataer) {
 // mainloop, read from in channel and write to out channel safely, write the item
 // exit when our context is closed
 func (b *FileDump) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-b.inchan:
 			if !ok {
 				return
 			}
 			b.writeandRespond(t)
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (FileDump) NewWithChannel(in chan Dataer) *FileDump {
-	con, cancel := context.WithCancel(context.Background())
-	r := FileDump{received: 0, ctx: con, can: cancel, inchan: in, wg: new(sync.WaitGroup)}
+func (f FileDump) NewWithChannel(in chan Dataer) *FileDump {
+	return f.NewWithContext(context.Background(), in)
+}
+
+func (f FileDump) NewWithContext(ctx context.Context, in chan Dataer) *FileDump {
+	con, cancel := context.WithCancel(ctx)
+	r := FileDump{received: 0, ctx: con, can: cancel, inchan: in, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics), Metricfunc: f.Metricfunc}
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -120,7 +172,11 @@ func (FileDump) NewWithChannel(in chan Dataer) *FileDump {
 }
 
 func (f FileDump) NewWithPipeline(p Pipeline[Dataer]) *FileDump {
-	r := f.NewWithChannel(p.PipelineChan())
+	return f.NewWithPipelineContext(context.Background(), p)
+}
+
+func (f FileDump) NewWithPipelineContext(ctx context.Context, p Pipeline[Dataer]) *FileDump {
+	r := f.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -23,8 +23,11 @@ type FileReadPipe struct {
 	inchan  chan string
 	outchan chan Dataer
 
-	pl Pipeline[string]
-	wg *sync.WaitGroup
+	pl      Pipeline[string]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -56,13 +59,44 @@ func (f *FileReadPipe) Close() {
 	f.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (f FileReadPipe) Done() <-chan struct{} {
+	return f.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (f *FileReadPipe) Drain(ctx context.Context) error {
+	return drainPipe(ctx, f.pl, f.drain, f.done, f.can, f.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (f *FileReadPipe) SetMetrics(name string, m Metrics) {
+	f.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (f *FileReadPipe) Stats() Stats {
+	return f.metrics.stats(f.done, len(f.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (f *FileReadPipe) Upstreams() []any {
+	return upstreams(f.pl)
+}
+
 func (f *FileReadPipe) consumeFile(t string) {
+	f.metrics.in()
+	start := f.metrics.start()
 	dat, err := ioutil.ReadFile(t)
+	f.metrics.latency(start)
 	if err != nil {
+		f.metrics.error(err)
 		return
 	}
+	f.metrics.sending()
 	select {
 	case f.outchan <- File{Reference: t, data: dat}:
+		f.metrics.out()
 		os.Remove(t)
 	case <-f.ctx.Done():
 		return
@@ -72,25 +106,38 @@ func (f *FileReadPipe) consumeFile(t string) {
 // mainloop, read from in channel and write to out channel safely, log the item
 // exit when our context is closed
 func (f *FileReadPipe) mainloop() {
+	defer close(f.done)
 	defer f.wg.Done()
 	defer close(f.outchan)
 
+	stop := f.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(f.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-f.inchan:
 			if !ok {
 				return
 			}
 			f.consumeFile(t)
+		case <-stop:
+			stop = nil
 		case <-f.ctx.Done():
 			return
 		}
 	}
 }
 
-func (FileReadPipe) NewWithChannel(in chan string) *FileReadPipe {
-	con, cancel := context.WithCancel(context.Background())
-	r := FileReadPipe{ctx: con, can: cancel, wg: new(sync.WaitGroup), inchan: in, outchan: make(chan Dataer, CHANSIZE)}
+func (f FileReadPipe) NewWithChannel(in chan string) *FileReadPipe {
+	return f.NewWithContext(context.Background(), in)
+}
+
+func (FileReadPipe) NewWithContext(ctx context.Context, in chan string) *FileReadPipe {
+	con, cancel := context.WithCancel(ctx)
+	r := FileReadPipe{ctx: con, can: cancel, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics), inchan: in, outchan: make(chan Dataer, CHANSIZE)}
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -99,7 +146,11 @@ func (FileReadPipe) NewWithChannel(in chan string) *FileReadPipe {
 }
 
 func (f FileReadPipe) NewWithPipeline(p Pipeline[string]) *FileReadPipe {
-	r := f.NewWithChannel(p.PipelineChan())
+	return f.NewWithPipelineContext(context.Background(), p)
+}
+
+func (f FileReadPipe) NewWithPipelineContext(ctx context.Context, p Pipeline[string]) *FileReadPipe {
+	r := f.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -12,8 +12,11 @@ type FileWriterPipe struct {
 
 	inchan chan FileNamerDataer
 
-	pl Pipeline[FileNamerDataer]
-	wg *sync.WaitGroup
+	pl      Pipeline[FileNamerDataer]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // InChan returns a write only channel that the incomming packets will be read from
@@ -35,44 +38,91 @@ func (b *FileWriterPipe) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b FileWriterPipe) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *FileWriterPipe) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *FileWriterPipe) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *FileWriterPipe) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *FileWriterPipe) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 func (b *FileWriterPipe) writefile(t FileNamerDataer) {
 	tmpName := "." + t.FileName()
 	tmpFd, err := os.Create(tmpName)
 	if err != nil {
+		b.metrics.error(err)
 		return
 	}
 
 	_, err = tmpFd.Write(t.Data())
 	if err != nil {
 		tmpFd.Close()
+		b.metrics.error(err)
 		return
 	}
 	tmpFd.Close()
 
-	os.Rename(tmpName, t.FileName())
+	if err := os.Rename(tmpName, t.FileName()); err != nil {
+		b.metrics.error(err)
+		return
+	}
+	b.metrics.out()
 }
 
 // mainloop, read from in channel and write to out channel safely, write the item
 // exit when our context is closed
 func (b *FileWriterPipe) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-b.inchan:
 			if !ok {
 				return
 			}
+			b.metrics.in()
+			start := b.metrics.start()
 			b.writefile(t)
+			b.metrics.latency(start)
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (FileWriterPipe) NewWithChannel(in chan FileNamerDataer) *FileWriterPipe {
-	con, cancel := context.WithCancel(context.Background())
-	r := FileWriterPipe{ctx: con, can: cancel, inchan: in, wg: new(sync.WaitGroup)}
+func (f FileWriterPipe) NewWithChannel(in chan FileNamerDataer) *FileWriterPipe {
+	return f.NewWithContext(context.Background(), in)
+}
+
+func (FileWriterPipe) NewWithContext(ctx context.Context, in chan FileNamerDataer) *FileWriterPipe {
+	con, cancel := context.WithCancel(ctx)
+	r := FileWriterPipe{ctx: con, can: cancel, inchan: in, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics)}
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -81,7 +131,11 @@ func (FileWriterPipe) NewWithChannel(in chan FileNamerDataer) *FileWriterPipe {
 }
 
 func (f FileWriterPipe) NewWithPipeline(p Pipeline[FileNamerDataer]) *FileWriterPipe {
-	r := f.NewWithChannel(p.PipelineChan())
+	return f.NewWithPipelineContext(context.Background(), p)
+}
+
+func (f FileWriterPipe) NewWithPipelineContext(ctx context.Context, p Pipeline[FileNamerDataer]) *FileWriterPipe {
+	r := f.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -15,8 +15,14 @@ type GeneratorPipe[T any] struct {
 
 	generate func() T
 
-	wg *sync.WaitGroup
-
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+
+	// Metricfunc is sent "count" for each item we generate, set it on the receiver of New.
+	//
+	// Deprecated: use SetMetrics, ProtoMetrics sends the gobase.MetricsProto form
 	Metricfunc func(gobase.MetricsProto)
 }
 
@@ -47,31 +53,70 @@ func (g *GeneratorPipe[T]) Close() {
 	g.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (g GeneratorPipe[_]) Done() <-chan struct{} {
+	return g.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (g *GeneratorPipe[T]) Drain(ctx context.Context) error {
+	return drainPipe[T](ctx, nil, g.drain, g.done, g.can, g.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (g *GeneratorPipe[T]) SetMetrics(name string, m Metrics) {
+	g.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (g *GeneratorPipe[T]) Stats() Stats {
+	return g.metrics.stats(g.done, 0)
+}
+
+// Upstreams returns nil as we are a source
+func (g *GeneratorPipe[T]) Upstreams() []any {
+	return nil
+}
+
 // mainloop, read from in channel and write to out channel safely
 // exit when our context is closed
 func (g *GeneratorPipe[T]) mainloop() {
+	defer close(g.done)
 	defer g.wg.Done()
 	defer close(g.outchan)
 
 	for {
+		g.metrics.sending()
 		select {
 		case g.outchan <- g.generate():
 			g.incMetric("count")
+			g.metrics.out()
+		case <-g.drain.ch:
+			return
 		case <-g.ctx.Done():
 			return
 		}
 	}
 }
 
-func (GeneratorPipe[T]) New(fun func() T) *GeneratorPipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (g GeneratorPipe[T]) New(fun func() T) *GeneratorPipe[T] {
+	return g.NewWithContext(context.Background(), fun)
+}
+
+func (g GeneratorPipe[T]) NewWithContext(ctx context.Context, fun func() T) *GeneratorPipe[T] {
+	con, cancel := context.WithCancel(ctx)
 
 	r := GeneratorPipe[T]{
 		ctx:      con,
 		can:      cancel,
 		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{}),
+		drain:    newSignal(),
+		metrics:  new(stageMetrics),
 		generate: fun,
-		outchan:  make(chan T, CHANSIZE)}
+		outchan:  make(chan T, CHANSIZE),
+
+		Metricfunc: g.Metricfunc}
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -3,6 +3,7 @@ package pipelines_test
 import (
 	"fmt"
 
+	"github.com/sterlingdevils/gobase"
 	"github.com/sterlingdevils/pipelines"
 )
 
@@ -32,3 +33,20 @@ func ExampleGeneratorPipe_increment() {
 	// 9
 	// 10
 }
+
+// Metricfunc is copied by New so it has to be set on the receiver
+func ExampleGeneratorPipe_Metricfunc() {
+	counts := make(map[string]int)
+	gen := pipelines.GeneratorPipe[int]{Metricfunc: func(m gobase.MetricsProto) {
+		counts[m.Name]++
+	}}.New(func() int { return 1 })
+
+	for j := 0; j < 3; j++ {
+		<-gen.OutChan()
+	}
+
+	gen.Close()
+	fmt.Println(counts)
+	// Output:
+	// map[count:3]
+}
@@ -0,0 +1,235 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrUnknownInput = errors.New("unknown input")
+	ErrInputInUse   = errors.New("input already used by another stage")
+	ErrTypeMismatch = errors.New("type mismatch")
+	ErrCycle        = errors.New("cycle in graph")
+)
+
+// StageConfig is one stage of a graph.  Type is the registry name, Input is the name
+// of the stage we read from and is left out for a source
+type StageConfig struct {
+	Name   string         `json:"name"`
+	Type   string         `json:"type"`
+	Input  string         `json:"input,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// GraphConfig is a pipeline graph read from a config file.  Each stage has one input and
+// each output is read by one stage, so a graph is one or more chains.
+// Only JSON is read, see LoadGraph, there is no YAML loader
+type GraphConfig struct {
+	Stages []StageConfig `json:"stages"`
+}
+
+// planned is a checked stage ready to build
+type planned struct {
+	cfg     StageConfig
+	factory StageFactory
+	params  Params
+}
+
+// plan checks the config against the registry and returns the stages in the
+// order they must be built, sources first
+func (g GraphConfig) plan(reg *Registry) ([]planned, error) {
+	byname := make(map[string]planned, len(g.Stages))
+	readby := make(map[string]string, len(g.Stages))
+
+	for _, s := range g.Stages {
+		if s.Name == "" {
+			return nil, fmt.Errorf("stage of type %v: %w", s.Type, ErrNilStage)
+		}
+		if _, ok := byname[s.Name]; ok {
+			return nil, fmt.Errorf("stage %v: %w", s.Name, ErrDuplicateStage)
+		}
+
+		f, err := reg.Get(s.Type)
+		if err != nil {
+			return nil, fmt.Errorf("stage %v: %w", s.Name, err)
+		}
+
+		p, err := f.params(s.Params)
+		if err != nil {
+			return nil, fmt.Errorf("stage %v: %w", s.Name, err)
+		}
+
+		byname[s.Name] = planned{cfg: s, factory: f, params: p}
+	}
+
+	for _, s := range g.Stages {
+		f := byname[s.Name].factory
+		switch {
+		case f.In == nil && s.Input != "":
+			return nil, fmt.Errorf("stage %v: %v is a source and takes no input: %w", s.Name, s.Type, ErrTypeMismatch)
+		case f.In == nil:
+			continue
+		case s.Input == "":
+			return nil, fmt.Errorf("stage %v: %v needs an input of %v: %w", s.Name, s.Type, f.In, ErrUnknownInput)
+		}
+
+		in, ok := byname[s.Input]
+		if !ok {
+			return nil, fmt.Errorf("stage %v: %w %v", s.Name, ErrUnknownInput, s.Input)
+		}
+		if other, ok := readby[s.Input]; ok {
+			return nil, fmt.Errorf("stage %v: %v is read by %v: %w", s.Name, s.Input, other, ErrInputInUse)
+		}
+		readby[s.Input] = s.Name
+
+		if in.factory.Out == nil {
+			return nil, fmt.Errorf("stage %v: input %v is a sink with no output: %w", s.Name, s.Input, ErrTypeMismatch)
+		}
+		if in.factory.Out != f.In {
+			return nil, fmt.Errorf("stage %v: input %v writes %v but %v reads %v: %w",
+				s.Name, s.Input, in.factory.Out, s.Type, f.In, ErrTypeMismatch)
+		}
+	}
+
+	// Walk back from each stage to its source, a stage we meet twice on one walk is a cycle
+	order := make([]planned, 0, len(g.Stages))
+	added := make(map[string]bool, len(g.Stages))
+	for _, s := range g.Stages {
+		var walk []string
+		seen := make(map[string]bool)
+		for n := s.Name; n != "" && !added[n]; n = byname[n].cfg.Input {
+			if seen[n] {
+				return nil, fmt.Errorf("stage %v: %w", n, ErrCycle)
+			}
+			seen[n] = true
+			walk = append(walk, n)
+		}
+
+		for i := len(walk) - 1; i >= 0; i-- {
+			added[walk[i]] = true
+			order = append(order, byname[walk[i]])
+		}
+	}
+
+	return order, nil
+}
+
+// Validate checks the config against the registry without building anything
+func (g GraphConfig) Validate(reg *Registry) error {
+	_, err := g.plan(reg)
+	return err
+}
+
+// Graph is a running set of stages built from a GraphConfig
+type Graph struct {
+	names  []string
+	stages map[string]Closer
+	tails  []Closer
+}
+
+// BuildGraph checks the config then builds and starts every stage.  If a stage fails
+// to build, the stages already started are closed.  ctx is passed to the factories,
+// every stage uses it so cancelling ctx stops the graph
+func BuildGraph(ctx context.Context, cfg GraphConfig, reg *Registry) (*Graph, error) {
+	order, err := cfg.plan(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{stages: make(map[string]Closer, len(order))}
+	read := make(map[string]bool, len(order))
+	for _, p := range order {
+		var in Closer
+		if p.cfg.Input != "" {
+			in = g.stages[p.cfg.Input]
+		}
+
+		c, err := p.factory.Build(ctx, in, p.params)
+		if err == nil && isNil(c) {
+			err = ErrNilStage
+		}
+		if err != nil {
+			g.tails = g.findTails(read)
+			g.Close()
+			return nil, fmt.Errorf("stage %v: %w", p.cfg.Name, err)
+		}
+
+		g.names = append(g.names, p.cfg.Name)
+		g.stages[p.cfg.Name] = c
+		read[p.cfg.Input] = true
+	}
+	g.tails = g.findTails(read)
+
+	return g, nil
+}
+
+// findTails returns the stages no one reads from, closing them closes the whole graph
+func (g *Graph) findTails(read map[string]bool) []Closer {
+	var tails []Closer
+	for _, n := range g.names {
+		if !read[n] {
+			tails = append(tails, g.stages[n])
+		}
+	}
+	return tails
+}
+
+// LoadGraph reads a JSON GraphConfig from r and builds it, see BuildGraph
+func LoadGraph(ctx context.Context, r io.Reader, reg *Registry) (*Graph, error) {
+	var cfg GraphConfig
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("reading graph config: %w", err)
+	}
+
+	return BuildGraph(ctx, cfg, reg)
+}
+
+// Close shuts down the graph, each chain is closed from its last stage
+func (g *Graph) Close() {
+	for _, t := range g.tails {
+		t.Close()
+	}
+}
+
+// Drain lets the items in the graph flow out before we shut down, see Drainer.
+// The first error is returned
+func (g *Graph) Drain(ctx context.Context) error {
+	var err error
+	for _, t := range g.tails {
+		var e error
+		if d, ok := t.(Drainer); ok {
+			e = d.Drain(ctx)
+		} else {
+			t.Close()
+		}
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Wait blocks until the last stage of each chain has stopped
+func (g *Graph) Wait() {
+	for _, t := range g.tails {
+		if d, ok := t.(interface{ Done() <-chan struct{} }); ok {
+			<-d.Done()
+		}
+	}
+}
+
+// Names returns the stage names in the order they were built
+func (g *Graph) Names() []string {
+	return append([]string(nil), g.names...)
+}
+
+// Stage returns the stage called name, or nil
+func (g *Graph) Stage(name string) any {
+	return g.stages[name]
+}
@@ -0,0 +1,76 @@
+package pipelines_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleLoadGraph() {
+	reg := pipelines.NewDefaultRegistry()
+	pipelines.RegisterSource(reg, "words",
+		[]pipelines.ParamSpec{{Name: "word", Kind: pipelines.PARAMSTRING, Required: true}},
+		func(ctx context.Context, p pipelines.Params) (pipelines.Pipeline[string], error) {
+			return pipelines.GeneratorPipe[string]{}.NewWithContext(ctx, func() string { return p.String("word") }), nil
+		})
+
+	cfg := `{"stages": [
+		{"name": "src", "type": "words", "params": {"word": "hello"}},
+		{"name": "buf", "type": "buffer.string", "input": "src", "params": {"size": 2}}
+	]}`
+
+	g, err := pipelines.LoadGraph(context.Background(), strings.NewReader(cfg), reg)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer g.Close()
+
+	out := g.Stage("buf").(pipelines.Pipeline[string])
+	fmt.Println(<-out.PipelineChan(), g.Names())
+	// Output:
+	// hello [src buf]
+}
+
+func ExampleGraphConfig_Validate() {
+	reg := pipelines.NewDefaultRegistry()
+
+	good := pipelines.GraphConfig{Stages: []pipelines.StageConfig{
+		{Name: "net", Type: "udp", Params: map[string]any{"addr": ":9200"}},
+		{Name: "sized", Type: "todatasizer.packet", Input: "net"},
+		{Name: "limit", Type: "ratelimit", Input: "sized", Params: map[string]any{"rate": 1e6, "burst": 65535.0}},
+		{Name: "data", Type: "todataer.datasizer", Input: "limit"},
+		{Name: "dump", Type: "filedump", Input: "data"},
+	}}
+	fmt.Println(good.Validate(reg))
+
+	bad := []pipelines.GraphConfig{
+		{Stages: []pipelines.StageConfig{
+			{Name: "net", Type: "udp", Params: map[string]any{"addr": ":9200"}},
+			{Name: "dump", Type: "filedump", Input: "net"}}},
+		{Stages: []pipelines.StageConfig{
+			{Name: "dump", Type: "filedump", Input: "nothere"}}},
+		{Stages: []pipelines.StageConfig{
+			{Name: "a", Type: "log.string", Input: "b"},
+			{Name: "b", Type: "log.string", Input: "a"}}},
+		{Stages: []pipelines.StageConfig{
+			{Name: "net", Type: "udp", Params: map[string]any{"port": 9200}}}},
+		{Stages: []pipelines.StageConfig{
+			{Name: "buf", Type: "buffer.string", Input: "x", Params: map[string]any{"size": "big"}}}},
+		{Stages: []pipelines.StageConfig{
+			{Name: "x", Type: "kafka"}}},
+	}
+	for _, b := range bad {
+		fmt.Println(b.Validate(reg))
+	}
+	// Output:
+	// <nil>
+	// stage dump: input net writes pipelines.Packetable but filedump reads pipelines.Dataer: type mismatch
+	// stage dump: unknown input nothere
+	// stage a: cycle in graph
+	// stage net: bad parameter: unknown parameter port
+	// stage buf: bad parameter: size wants int: got string
+	// stage x: unknown stage type: kafka
+}
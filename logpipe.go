@@ -15,8 +15,11 @@ type LogPipe[T any] struct {
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -50,35 +53,77 @@ func (b *LogPipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b LogPipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *LogPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *LogPipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *LogPipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *LogPipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely, log the item
 // exit when our context is closed
 func (b *LogPipe[_]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 	defer close(b.outchan)
 	defer log.Printf("<logpipe %v> closing output channel\n", b.name)
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-b.inchan:
 			if !ok {
 				return
 			}
+			b.metrics.in()
 			log.Printf("<logpipe %v> type:%v   value:%v\n", b.name, reflect.TypeOf(t), t)
+			b.metrics.sending()
 			select {
 			case b.outchan <- t:
+				b.metrics.out()
 			case <-b.ctx.Done():
 				return
 			}
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (LogPipe[T]) NewWithChannel(name string, in chan T) *LogPipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (b LogPipe[T]) NewWithChannel(name string, in chan T) *LogPipe[T] {
+	return b.NewWithContext(context.Background(), name, in)
+}
+
+func (LogPipe[T]) NewWithContext(ctx context.Context, name string, in chan T) *LogPipe[T] {
+	con, cancel := context.WithCancel(ctx)
 	r := LogPipe[T]{name: name,
 		ctx: con, can: cancel, wg: new(sync.WaitGroup),
+		done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics),
 		inchan: in, outchan: make(chan T, CHANSIZE)}
 	log.Printf("<logpipe %v> created\n", name)
 
@@ -89,7 +134,11 @@ func (LogPipe[T]) NewWithChannel(name string, in chan T) *LogPipe[T] {
 }
 
 func (b LogPipe[T]) NewWithPipeline(name string, p Pipeline[T]) *LogPipe[T] {
-	r := b.NewWithChannel(name, p.PipelineChan())
+	return b.NewWithPipelineContext(context.Background(), name, p)
+}
+
+func (b LogPipe[T]) NewWithPipelineContext(ctx context.Context, name string, p Pipeline[T]) *LogPipe[T] {
+	r := b.NewWithContext(ctx, name, p.PipelineChan())
 	r.pl = p
 	log.Printf("<logpipe %v> pipeline set\n", name)
 	return r
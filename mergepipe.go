@@ -0,0 +1,202 @@
+package pipelines
+
+import (
+	"context"
+	"sync"
+)
+
+// MergePipe reads from several inputs and writes everything onto one output channel.
+// The output is closed once all of the inputs are closed.
+type MergePipe[T any] struct {
+	ctx context.Context
+	can context.CancelFunc
+
+	inchans []chan T
+	outchan chan T
+
+	pls     []Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// InChan returns the i'th input channel
+func (m MergePipe[T]) InChan(i int) chan<- T {
+	return m.inchans[i]
+}
+
+// OutChan
+func (m MergePipe[T]) OutChan() <-chan T {
+	return m.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (m MergePipe[T]) PipelineChan() chan T {
+	return m.outchan
+}
+
+// Close
+func (m *MergePipe[_]) Close() {
+	// If we pipelined then call Close on all the input pipelines
+	for _, p := range m.pls {
+		p.Close()
+	}
+
+	// Cancel our context
+	m.can()
+
+	// Wait for us to be done
+	m.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (m MergePipe[_]) Done() <-chan struct{} {
+	return m.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer.
+// All of the input pipelines are drained at the same time.
+func (m *MergePipe[T]) Drain(ctx context.Context) error {
+	errs := make(chan error, len(m.pls))
+	for _, p := range m.pls {
+		go func(p Pipeline[T]) {
+			errs <- drainInput(ctx, p)
+		}(p)
+	}
+
+	var err error
+	for range m.pls {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+
+	e := drainPipe[T](ctx, nil, m.drain, m.done, m.can, m.wg)
+	if err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (m *MergePipe[T]) SetMetrics(name string, metrics Metrics) {
+	m.metrics.set(name, metrics)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (m *MergePipe[T]) Stats() Stats {
+	waiting := 0
+	for _, in := range m.inchans {
+		waiting += len(in)
+	}
+	return m.metrics.stats(m.done, waiting)
+}
+
+// Upstreams returns the pipelines we read from
+func (m *MergePipe[T]) Upstreams() []any {
+	ups := make([]any, 0, len(m.pls))
+	for _, p := range m.pls {
+		ups = append(ups, p)
+	}
+	return ups
+}
+
+// forward, read from one in channel and write to out channel safely
+// exit when the input is closed or our context is closed
+func (m *MergePipe[T]) forward(in chan T, fwg *sync.WaitGroup) {
+	defer fwg.Done()
+
+	stop := m.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(in) == 0 {
+			return
+		}
+
+		select {
+		case t, ok := <-in:
+			if !ok {
+				return
+			}
+			m.metrics.in()
+			m.metrics.sending()
+			select {
+			case m.outchan <- t:
+				m.metrics.out()
+			case <-m.ctx.Done():
+				return
+			}
+		case <-stop:
+			stop = nil
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// mainloop starts a forwarder for each input and closes the output when they are all done
+func (m *MergePipe[T]) mainloop() {
+	defer close(m.done)
+	defer m.wg.Done()
+	defer close(m.outchan)
+
+	fwg := new(sync.WaitGroup)
+	for _, in := range m.inchans {
+		fwg.Add(1)
+		go m.forward(in, fwg)
+	}
+
+	fwg.Wait()
+}
+
+func (m MergePipe[T]) NewWithChannels(ins []chan T) *MergePipe[T] {
+	return m.NewWithContext(context.Background(), ins)
+}
+
+func (MergePipe[T]) NewWithContext(ctx context.Context, ins []chan T) *MergePipe[T] {
+	con, cancel := context.WithCancel(ctx)
+
+	r := MergePipe[T]{
+		ctx:     con,
+		can:     cancel,
+		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
+		inchans: ins,
+		outchan: make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r
+}
+
+// NewWithPipeline merges all of ps, Close will close every one of them
+func (m MergePipe[T]) NewWithPipeline(ps []Pipeline[T]) *MergePipe[T] {
+	return m.NewWithPipelineContext(context.Background(), ps)
+}
+
+func (m MergePipe[T]) NewWithPipelineContext(ctx context.Context, ps []Pipeline[T]) *MergePipe[T] {
+	ins := make([]chan T, 0, len(ps))
+	for _, p := range ps {
+		ins = append(ins, p.PipelineChan())
+	}
+
+	r := m.NewWithContext(ctx, ins)
+	r.pls = ps
+
+	return r
+}
+
+// New creates a merge with n input channels
+func (m MergePipe[T]) New(n int) *MergePipe[T] {
+	ins := make([]chan T, n)
+	for i := range ins {
+		ins[i] = make(chan T, CHANSIZE)
+	}
+
+	return m.NewWithChannels(ins)
+}
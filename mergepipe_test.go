@@ -0,0 +1,47 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleMergePipe_New() {
+	m := pipelines.MergePipe[int]{}.New(2)
+
+	go func() { m.InChan(0) <- 1 }()
+	go func() { m.InChan(1) <- 2 }()
+
+	r := []int{<-m.OutChan(), <-m.OutChan()}
+	sort.Ints(r)
+	fmt.Println(r)
+
+	m.Close()
+	// Output:
+	// [1 2]
+}
+
+// The output is closed when all the inputs are closed
+func ExampleMergePipe_NewWithPipeline() {
+	a := pipelines.ConverterPipe[int, int]{}.New(func(i int) (int, error) { return i, nil })
+	b := pipelines.ConverterPipe[int, int]{}.New(func(i int) (int, error) { return i * 10, nil })
+	m := pipelines.MergePipe[int]{}.NewWithPipeline([]pipelines.Pipeline[int]{a, b})
+
+	go func() {
+		a.InChan() <- 1
+		b.InChan() <- 2
+		close(a.InChan())
+		close(b.InChan())
+	}()
+
+	sum := 0
+	for i := range m.OutChan() {
+		sum += i
+	}
+	fmt.Println(sum)
+
+	m.Close()
+	// Output:
+	// 21
+}
@@ -0,0 +1,233 @@
+package pipelines
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sterlingdevils/gobase"
+)
+
+// Metrics receives measurements from stages, each call is labeled with the stage
+// name given to SetMetrics.  It is called from the stage go routines so it must be
+// safe for concurrent use and should not block.
+type Metrics interface {
+	// ItemIn is called when a stage takes an item from its input
+	ItemIn(stage string)
+	// ItemOut is called when a stage has passed an item on
+	ItemOut(stage string)
+	// Dropped is called when a stage throws away n items
+	Dropped(stage string, n int)
+	// Error is called when a stage fails to handle an item
+	Error(stage string, err error)
+	// QueueDepth is the number of items a stage is holding or waiting on its input
+	QueueDepth(stage string, depth int)
+	// Latency is the time a stage spent on one item
+	Latency(stage string, d time.Duration)
+}
+
+// MetricsSetter is a stage that reports to a Metrics, every pipe in this package is one
+type MetricsSetter interface {
+	SetMetrics(name string, m Metrics)
+}
+
+// ProtoMetrics sends the counters to a func that takes gobase.MetricsProto, the same as
+// the Metricfunc on GeneratorPipe.  The names are stage.in, stage.out, stage.dropped and
+// stage.errors.  MetricsProto only counts so queue depth and latency are not sent.
+func ProtoMetrics(fun func(gobase.MetricsProto)) Metrics {
+	return protoMetrics(fun)
+}
+
+type protoMetrics func(gobase.MetricsProto)
+
+func (p protoMetrics) ItemIn(stage string) {
+	p(gobase.MetricsProto{Name: stage + ".in", Cmd: gobase.INC})
+}
+
+func (p protoMetrics) ItemOut(stage string) {
+	p(gobase.MetricsProto{Name: stage + ".out", Cmd: gobase.INC})
+}
+
+func (p protoMetrics) Dropped(stage string, n int) {
+	for i := 0; i < n; i++ {
+		p(gobase.MetricsProto{Name: stage + ".dropped", Cmd: gobase.INC})
+	}
+}
+
+func (p protoMetrics) Error(stage string, err error) {
+	p(gobase.MetricsProto{Name: stage + ".errors", Cmd: gobase.INC})
+}
+
+func (protoMetrics) QueueDepth(string, int) {}
+
+func (protoMetrics) Latency(string, time.Duration) {}
+
+// SetMetrics sets m on each stage that is a MetricsSetter, labeled with the stage name.
+// prefix is put in front of each name so more than one chain can share m
+func (h *Handle) SetMetrics(prefix string, m Metrics) {
+	setMetrics(prefix, h.stages.names, h.stages.byname, m)
+}
+
+// SetMetrics sets m on each stage that is a MetricsSetter, labeled with the stage name.
+// prefix is put in front of each name so more than one graph can share m
+func (g *Graph) SetMetrics(prefix string, m Metrics) {
+	stages := make(map[string]any, len(g.stages))
+	for n, s := range g.stages {
+		stages[n] = s
+	}
+	setMetrics(prefix, g.names, stages, m)
+}
+
+func setMetrics(prefix string, names []string, stages map[string]any, m Metrics) {
+	for _, n := range names {
+		if s, ok := stages[n].(MetricsSetter); ok {
+			s.SetMetrics(strings.TrimPrefix(prefix+"."+n, "."), m)
+		}
+	}
+}
+
+// metricsHook is the Metrics and the name we report as
+type metricsHook struct {
+	name string
+	m    Metrics
+}
+
+// stageMetrics is held by each pipe, it keeps the counts for Stats and sends
+// to the Metrics once SetMetrics is called.  It can be set while the pipe is running.
+// The times come from clock, pipes with a Clock pass theirs so a Watchdog on the same
+// FakeClock sees them, nil is RealClock
+type stageMetrics struct {
+	hook  atomic.Value
+	clock Clock
+
+	nin, nout, ndropped, nerrors uint64
+	held                         int64
+	lastIn, lastOut              int64
+	state                        int32
+	since                        int64
+}
+
+// newStageMetrics returns the metrics for a pipe that takes its times from c
+func newStageMetrics(c Clock) *stageMetrics {
+	return &stageMetrics{clock: c}
+}
+
+func (s *stageMetrics) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s *stageMetrics) set(name string, m Metrics) {
+	s.hook.Store(metricsHook{name: name, m: m})
+}
+
+func (s *stageMetrics) get() (metricsHook, bool) {
+	if s == nil {
+		return metricsHook{}, false
+	}
+	h, _ := s.hook.Load().(metricsHook)
+	return h, h.m != nil
+}
+
+// setState records what we are waiting on and when that started
+func (s *stageMetrics) setState(st StageState) {
+	if StageState(atomic.SwapInt32(&s.state, int32(st))) != st {
+		atomic.StoreInt64(&s.since, s.now().UnixNano())
+	}
+}
+
+func (s *stageMetrics) in() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.nin, 1)
+	atomic.StoreInt64(&s.lastIn, s.now().UnixNano())
+	s.setState(STATEWORKING)
+
+	if h, ok := s.get(); ok {
+		h.m.ItemIn(h.name)
+	}
+}
+
+func (s *stageMetrics) out() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.nout, 1)
+	atomic.StoreInt64(&s.lastOut, s.now().UnixNano())
+	s.setState(STATERECEIVING)
+
+	if h, ok := s.get(); ok {
+		h.m.ItemOut(h.name)
+	}
+}
+
+// sending is called before we block writing to our output
+func (s *stageMetrics) sending() {
+	if s == nil {
+		return
+	}
+	s.setState(STATESENDING)
+}
+
+// receiving is called when we are done with an item and wait for the next one
+func (s *stageMetrics) receiving() {
+	if s == nil {
+		return
+	}
+	s.setState(STATERECEIVING)
+}
+
+func (s *stageMetrics) dropped(n int) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.ndropped, uint64(n))
+	s.setState(STATERECEIVING)
+
+	if h, ok := s.get(); ok {
+		h.m.Dropped(h.name, n)
+	}
+}
+
+func (s *stageMetrics) error(err error) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.nerrors, 1)
+	s.setState(STATERECEIVING)
+
+	if h, ok := s.get(); ok {
+		h.m.Error(h.name, err)
+	}
+}
+
+func (s *stageMetrics) depth(n int) {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt64(&s.held, int64(n))
+
+	if h, ok := s.get(); ok {
+		h.m.QueueDepth(h.name, n)
+	}
+}
+
+// start returns the time to pass to latency, it is zero when no one is listening
+func (s *stageMetrics) start() time.Time {
+	if _, ok := s.get(); ok {
+		return s.now()
+	}
+	return time.Time{}
+}
+
+func (s *stageMetrics) latency(start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	if h, ok := s.get(); ok {
+		h.m.Latency(h.name, s.now().Sub(start))
+	}
+}
@@ -0,0 +1,106 @@
+package pipelines_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sterlingdevils/gobase"
+	"github.com/sterlingdevils/pipelines"
+)
+
+// countMetrics counts each call by stage
+type countMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countMetrics) add(name string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name] += n
+}
+
+func (c *countMetrics) ItemIn(stage string)           { c.add(stage+".in", 1) }
+func (c *countMetrics) ItemOut(stage string)          { c.add(stage+".out", 1) }
+func (c *countMetrics) Dropped(stage string, n int)   { c.add(stage+".dropped", n) }
+func (c *countMetrics) Error(stage string, err error) { c.add(stage+".errors", 1) }
+func (c *countMetrics) QueueDepth(string, int)        {}
+func (c *countMetrics) Latency(string, time.Duration) {}
+
+func (c *countMetrics) print() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.counts))
+	for n := range c.counts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Println(n, c.counts[n])
+	}
+}
+
+func ExampleMetrics() {
+	in := make(chan int)
+	h, err := pipelines.Via(
+		pipelines.From[int]("buffer", must(pipelines.BufferPipe[int]{}.NewWithChannel(5, in))),
+		"convert", pipelines.Wrap[int, string](func(p pipelines.Pipeline[int]) *pipelines.ConverterPipe[int, string] {
+			return pipelines.ConverterPipe[int, string]{}.NewWithPipeline(p, func(i int) (string, error) {
+				if i%2 == 1 {
+					return "", errors.New("odd")
+				}
+				return fmt.Sprint(i), nil
+			})
+		})).
+		To("null", pipelines.WrapSink(pipelines.NullConsumePipe[string]{}.NewWithPipeline))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	m := &countMetrics{counts: make(map[string]int)}
+	h.SetMetrics("chain", m)
+
+	for i := 0; i < 4; i++ {
+		in <- i
+	}
+	close(in)
+	h.Wait()
+	h.Close()
+
+	m.print()
+	// Output:
+	// chain.buffer.in 4
+	// chain.buffer.out 4
+	// chain.convert.errors 2
+	// chain.convert.in 4
+	// chain.convert.out 2
+	// chain.null.in 2
+}
+
+func ExampleProtoMetrics() {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	m := pipelines.ProtoMetrics(func(mp gobase.MetricsProto) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[mp.Name]++
+	})
+
+	skip := pipelines.AsyncSkipPipe[int]{}.New()
+	skip.SetMetrics("skip", m)
+
+	// No one is reading so this is dropped
+	skip.InChan() <- 1
+	skip.Close()
+
+	mu.Lock()
+	fmt.Println(counts["skip.in"], counts["skip.dropped"])
+	mu.Unlock()
+	// Output:
+	// 1 1
+}
@@ -11,8 +11,11 @@ type NullConsumePipe[T any] struct {
 
 	inchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -34,26 +37,67 @@ func (b *NullConsumePipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b NullConsumePipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *NullConsumePipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *NullConsumePipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *NullConsumePipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *NullConsumePipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely, log the item
 // exit when our context is closed
 func (b *NullConsumePipe[_]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
 		case _, ok := <-b.inchan:
 			if !ok {
 				return
 			}
+			b.metrics.in()
+			b.metrics.receiving()
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (NullConsumePipe[T]) NewWithChannel(in chan T) *NullConsumePipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (n NullConsumePipe[T]) NewWithChannel(in chan T) *NullConsumePipe[T] {
+	return n.NewWithContext(context.Background(), in)
+}
+
+func (NullConsumePipe[T]) NewWithContext(ctx context.Context, in chan T) *NullConsumePipe[T] {
+	con, cancel := context.WithCancel(ctx)
 	r := NullConsumePipe[T]{ctx: con, can: cancel, wg: new(sync.WaitGroup),
+		done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics),
 		inchan: in}
 
 	r.wg.Add(1)
@@ -63,7 +107,11 @@ func (NullConsumePipe[T]) NewWithChannel(in chan T) *NullConsumePipe[T] {
 }
 
 func (n NullConsumePipe[T]) NewWithPipeline(p Pipeline[T]) *NullConsumePipe[T] {
-	r := n.NewWithChannel(p.PipelineChan())
+	return n.NewWithPipelineContext(context.Background(), p)
+}
+
+func (n NullConsumePipe[T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T]) *NullConsumePipe[T] {
+	r := n.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -18,8 +18,14 @@ type OnlyOncePipe[T comparable] struct {
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+
+	// Clock is used for the GC and forget times, nil is RealClock
+	Clock Clock
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -51,21 +57,54 @@ func (b *OnlyOncePipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b OnlyOncePipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *OnlyOncePipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *OnlyOncePipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *OnlyOncePipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *OnlyOncePipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely,
-// add it to the map if it isn't already there. Exit when our context is closed
+// add it to the map if it isn't already there. Exit when our context is closed.
+// The map is the items we have seen, not ones we hold, so we report no depth
 func (b *OnlyOncePipe[_]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 	defer close(b.outchan)
 
-	ticker := time.NewTicker(b.gctime)
+	ticker := b.Clock.NewTicker(b.gctime)
 	defer ticker.Stop()
 
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			log.Printf("tick tock\n")
 			for m, val := range b.smap {
-				if time.Since(val) > b.frtime {
+				if b.Clock.Since(val) > b.frtime {
 					log.Printf("Removing: %v from oop with time %v\n", m, val)
 					delete(b.smap, m)
 				}
@@ -74,26 +113,38 @@ func (b *OnlyOncePipe[_]) mainloop() {
 			if !ok {
 				return
 			}
+			b.metrics.in()
 			_, ok = b.smap[t]
-			if !ok {
-				b.smap[t] = time.Now()
-				select {
-				case b.outchan <- t:
-				case <-b.ctx.Done():
-					return
-				}
+			if ok {
+				b.metrics.dropped(1)
+				break
+			}
+			b.smap[t] = b.Clock.Now()
+			b.metrics.sending()
+			select {
+			case b.outchan <- t:
+				b.metrics.out()
+			case <-b.ctx.Done():
+				return
 			}
+		case <-stop:
+			stop = nil
 		case <-b.ctx.Done():
 			return
 		}
 	}
 }
 
-func (OnlyOncePipe[T]) NewWithChannel(gc time.Duration, fr time.Duration, in chan T) *OnlyOncePipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (b OnlyOncePipe[T]) NewWithChannel(gc time.Duration, fr time.Duration, in chan T) *OnlyOncePipe[T] {
+	return b.NewWithContext(context.Background(), gc, fr, in)
+}
+
+func (b OnlyOncePipe[T]) NewWithContext(ctx context.Context, gc time.Duration, fr time.Duration, in chan T) *OnlyOncePipe[T] {
+	con, cancel := context.WithCancel(ctx)
 	r := OnlyOncePipe[T]{smap: make(map[T]time.Time), gctime: gc, frtime: fr,
 		ctx: con, can: cancel, wg: new(sync.WaitGroup),
-		inchan: in, outchan: make(chan T, CHANSIZE)}
+		done: make(chan struct{}), drain: newSignal(), metrics: newStageMetrics(b.Clock),
+		inchan: in, outchan: make(chan T, CHANSIZE), Clock: orRealClock(b.Clock)}
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -102,7 +153,11 @@ func (OnlyOncePipe[T]) NewWithChannel(gc time.Duration, fr time.Duration, in cha
 }
 
 func (b OnlyOncePipe[T]) NewWithPipeline(gc time.Duration, fr time.Duration, p Pipeline[T]) *OnlyOncePipe[T] {
-	r := b.NewWithChannel(gc, fr, p.PipelineChan())
+	return b.NewWithPipelineContext(context.Background(), gc, fr, p)
+}
+
+func (b OnlyOncePipe[T]) NewWithPipelineContext(ctx context.Context, gc time.Duration, fr time.Duration, p Pipeline[T]) *OnlyOncePipe[T] {
+	r := b.NewWithContext(ctx, gc, fr, p.PipelineChan())
 	r.pl = p
 	return r
 }
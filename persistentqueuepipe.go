@@ -0,0 +1,257 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PersistentQueuePipe writes each item to a log on disk before passing it on and keeps
+// it there until its key is acked on AckIn.  When we are created, the items in the log
+// that were never acked are sent before anything new, so items are not lost when the
+// process stops.  Items are sent at least once, after a restart some may be sent again.
+//
+// Set the options before calling New, for example
+// PersistentQueuePipe[K, T]{Codec: c, Sync: true}.New(dir)
+type PersistentQueuePipe[K comparable, T Keyer[K]] struct {
+	// Codec turns items into bytes for the log, nil is JSONCodec
+	Codec Codec[T]
+
+	// SegmentSize is the size a log file grows to before we start a new one, 0 is SEGMENTSIZE
+	SegmentSize int64
+
+	// Sync flushes each write to the disk so a power loss doesn't lose items, it is slow
+	Sync bool
+
+	log *wal
+
+	// replay is the items from the log to send first, seqs is the log records for each key not acked
+	replay []T
+	seqs   map[K][]uint64
+
+	inchan  chan T
+	outchan chan T
+	ackin   chan K
+
+	ctx context.Context
+	can context.CancelFunc
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// InChan
+func (q PersistentQueuePipe[_, T]) InChan() chan<- T {
+	return q.inchan
+}
+
+// OutChan
+func (q PersistentQueuePipe[_, T]) OutChan() <-chan T {
+	return q.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (q PersistentQueuePipe[_, T]) PipelineChan() chan T {
+	return q.outchan
+}
+
+// AckIn takes the keys of items that have been handled, they are removed from the log
+func (q PersistentQueuePipe[K, _]) AckIn() chan<- K {
+	return q.ackin
+}
+
+// Close stops us, the items that have not been acked stay in the log for next time
+func (q *PersistentQueuePipe[_, _]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if q.pl != nil {
+		q.pl.Close()
+	}
+
+	// Cancel our context
+	q.can()
+
+	// Wait for us to be done
+	q.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (q PersistentQueuePipe[_, _]) Done() <-chan struct{} {
+	return q.done
+}
+
+// Drain lets the items waiting to be sent flow out before we shut down, see Drainer.
+// Items that have not been acked stay in the log
+func (q *PersistentQueuePipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, q.pl, q.drain, q.done, q.can, q.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (q *PersistentQueuePipe[_, _]) SetMetrics(name string, m Metrics) {
+	q.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (q *PersistentQueuePipe[_, _]) Stats() Stats {
+	return q.metrics.stats(q.done, len(q.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (q *PersistentQueuePipe[_, _]) Upstreams() []any {
+	return upstreams(q.pl)
+}
+
+// add writes t to the log and queues it to be sent.  If it can't be written
+// we report the error and still send it
+func (q *PersistentQueuePipe[_, T]) add(queue []T, t T) []T {
+	queue = append(queue, t)
+
+	b, err := q.Codec.Encode(t)
+	if err != nil {
+		q.metrics.error(err)
+		return queue
+	}
+	seq, err := q.log.append(b)
+	if err != nil {
+		q.metrics.error(err)
+		return queue
+	}
+	k := t.Key()
+	q.seqs[k] = append(q.seqs[k], seq)
+	return queue
+}
+
+// ack removes every record for k from the log
+func (q *PersistentQueuePipe[K, _]) ack(k K) {
+	for _, seq := range q.seqs[k] {
+		if err := q.log.ack(seq); err != nil {
+			q.metrics.error(err)
+		}
+	}
+	delete(q.seqs, k)
+}
+
+// mainloop, read from in channel, log and queue the items, write them to the out channel
+// and remove them from the log when acked.  On input close we send what we have queued,
+// exit when our context is closed
+func (q *PersistentQueuePipe[_, T]) mainloop() {
+	defer close(q.done)
+	defer q.wg.Done()
+	defer close(q.outchan)
+	defer q.log.close()
+
+	queue := q.replay
+	in := q.inchan
+	stop := q.drain.ch
+	for {
+		q.metrics.depth(len(queue))
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && len(queue) == 0 {
+			return
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if len(queue) > 0 {
+			out, head = q.outchan, queue[0]
+			q.metrics.sending()
+		} else {
+			q.metrics.receiving()
+		}
+
+		select {
+		case out <- head:
+			queue = popFront(queue)
+			q.metrics.out()
+		case t, ok := <-in:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			q.metrics.in()
+			queue = q.add(queue, t)
+		case k := <-q.ackin:
+			q.ack(k)
+		case <-stop:
+			stop = nil
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// NewWithChannel keeps the log in dir, it is created if needed.  Only one pipe can use a dir
+func (q PersistentQueuePipe[K, T]) NewWithChannel(dir string, in chan T) (*PersistentQueuePipe[K, T], error) {
+	return q.NewWithContext(context.Background(), dir, in)
+}
+
+func (q PersistentQueuePipe[K, T]) NewWithContext(ctx context.Context, dir string, in chan T) (*PersistentQueuePipe[K, T], error) {
+	codec := q.Codec
+	if codec == nil {
+		codec = JSONCodec[T]{}
+	}
+
+	log, items, err := openWAL(dir, q.SegmentSize, q.Sync)
+	if err != nil {
+		return nil, err
+	}
+
+	// The items from last time go first
+	replay := make([]T, 0, len(items))
+	seqs := make(map[K][]uint64, len(items))
+	for _, it := range items {
+		t, err := codec.Decode(it.payload)
+		if err != nil {
+			log.close()
+			return nil, fmt.Errorf("log record %v: %w", it.seq, err)
+		}
+		replay = append(replay, t)
+		seqs[t.Key()] = append(seqs[t.Key()], it.seq)
+	}
+
+	con, cancel := context.WithCancel(ctx)
+	r := PersistentQueuePipe[K, T]{
+		Codec:       codec,
+		SegmentSize: q.SegmentSize,
+		Sync:        q.Sync,
+		log:         log,
+		replay:      replay,
+		seqs:        seqs,
+		inchan:      in,
+		outchan:     make(chan T, CHANSIZE),
+		ackin:       make(chan K, CHANSIZE),
+		ctx:         con,
+		can:         cancel,
+		wg:          new(sync.WaitGroup),
+		done:        make(chan struct{}),
+		drain:       newSignal(),
+		metrics:     new(stageMetrics)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (q PersistentQueuePipe[K, T]) NewWithPipeline(dir string, p Pipeline[T]) (*PersistentQueuePipe[K, T], error) {
+	return q.NewWithPipelineContext(context.Background(), dir, p)
+}
+
+func (q PersistentQueuePipe[K, T]) NewWithPipelineContext(ctx context.Context, dir string, p Pipeline[T]) (*PersistentQueuePipe[K, T], error) {
+	r, err := q.NewWithContext(ctx, dir, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (q PersistentQueuePipe[K, T]) New(dir string) (*PersistentQueuePipe[K, T], error) {
+	return q.NewWithChannel(dir, make(chan T, CHANSIZE))
+}
@@ -0,0 +1,85 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+type job struct {
+	ID   int
+	Name string
+}
+
+func (j job) Key() int {
+	return j.ID
+}
+
+func ExamplePersistentQueuePipe() {
+	dir, _ := os.MkdirTemp("", "queue")
+	defer os.RemoveAll(dir)
+
+	q, err := pipelines.PersistentQueuePipe[int, job]{}.New(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	q.InChan() <- job{ID: 1, Name: "first"}
+	q.InChan() <- job{ID: 2, Name: "second"}
+	fmt.Println(<-q.OutChan(), <-q.OutChan())
+
+	// Only the first is acked before we stop
+	q.AckIn() <- 1
+	q.Close()
+
+	// The second is sent again when we start
+	q, err = pipelines.PersistentQueuePipe[int, job]{}.New(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(<-q.OutChan())
+	q.AckIn() <- 2
+	q.Close()
+	// Output:
+	// {1 first} {2 second}
+	// {2 second}
+}
+
+// A record cut short by a crash is skipped and the ones before it are kept
+func ExamplePersistentQueuePipe_recovery() {
+	dir, _ := os.MkdirTemp("", "queue")
+	defer os.RemoveAll(dir)
+
+	q, _ := pipelines.PersistentQueuePipe[int, job]{SegmentSize: 64}.New(dir)
+	for i := 1; i <= 3; i++ {
+		q.InChan() <- job{ID: i, Name: "job"}
+		<-q.OutChan()
+	}
+	q.Close()
+
+	// Half a record at the end of the last segment
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	f, _ := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte{1, 0, 0, 0})
+	f.Close()
+
+	q, _ = pipelines.PersistentQueuePipe[int, job]{SegmentSize: 64}.New(dir)
+	for i := 1; i <= 3; i++ {
+		j := <-q.OutChan()
+		fmt.Println(j.ID)
+		q.AckIn() <- j.ID
+	}
+	q.Close()
+
+	// Once everything is acked only the segment we were writing to is left
+	segs, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+	fmt.Println(len(segs))
+	// Output:
+	// 1
+	// 2
+	// 3
+	// 1
+}
@@ -1,5 +1,7 @@
 package pipelines
 
+import "time"
+
 const (
 	CHANSIZE = 0
 )
@@ -37,6 +39,16 @@ type Keyer[K comparable] interface {
 	Key() K
 }
 
+// Prioritizer is an item that knows its priority, higher goes first
+type Prioritizer interface {
+	Priority() int
+}
+
+// Deadliner is an item that knows when it should be released
+type Deadliner interface {
+	Deadline() time.Time
+}
+
 type FileNamer interface {
 	FileName() string
 }
@@ -0,0 +1,406 @@
+/*
+  Package pipetest checks that a stage behaves like the pipes in pipelines do.
+
+  Run it from a test with the constructor of the stage, for a stage that passes
+  items through unchanged:
+
+	func TestMyPipe(t *testing.T) {
+		pipetest.Run(t, func(i int) int { return i },
+			func(in pipelines.Pipeline[int]) pipelines.Pipeline[int] {
+				return MyPipe[int]{}.NewWithPipeline(in)
+			})
+	}
+
+  Stages that change the items, or take a context, use a Suite.  Each check is a
+  subtest:
+
+	Order            the items come out in order, or at least all of them if Unordered
+	ClosedInput      the output is closed once the input is closed
+	ClosePropagates  Close returns, calls Close on the input pipeline and closes the output
+	CloseBlocked     Close returns while the stage is stuck writing to its output
+	Cancel           cancelling the context closes the output, only if NewWithContext is set
+
+  After each check we wait for the number of goroutines to go back to what it was
+  before the stage was built and report a leak if it doesn't.  Tests that run in
+  parallel with the suite will confuse this.
+
+  Always run the suite with the race detector, go test -race ./...  A stage whose
+  methods copy or read state its mainloop is writing, such as a value receiver on a
+  struct with a field the mainloop changes, passes every check without it.
+*/
+package pipetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+const (
+	// ITEMS is the default number of items we send through the stage
+	ITEMS = 100
+	// TIMEOUT is the default time we wait for the stage to do something
+	TIMEOUT = 5 * time.Second
+)
+
+// Suite is the stage under test and what to expect from it
+type Suite[I, O any] struct {
+	// New builds the stage reading from in, it must keep in so Close is passed on
+	New func(in pipelines.Pipeline[I]) pipelines.Pipeline[O]
+
+	// NewWithContext builds the stage reading from in, cancelling ctx must stop it.
+	// The Cancel check is skipped if it is nil
+	NewWithContext func(ctx context.Context, in chan I) pipelines.Pipeline[O]
+
+	// Item makes the i'th input
+	Item func(i int) I
+
+	// Want is the output for the i'th input, if nil the outputs are not checked
+	Want func(i int) O
+
+	// Unordered stages only need to send every item, in any order
+	Unordered bool
+
+	// Items is the number of items to send, defaults to ITEMS
+	Items int
+
+	// Timeout is how long we wait for the stage, defaults to TIMEOUT
+	Timeout time.Duration
+}
+
+// Run checks a stage that passes items through unchanged and in order
+func Run[T any](t *testing.T, item func(i int) T, new func(in pipelines.Pipeline[T]) pipelines.Pipeline[T]) {
+	t.Helper()
+	Suite[T, T]{New: new, Item: item, Want: item}.Run(t)
+}
+
+// Run runs each check as a subtest of t
+func (s Suite[I, O]) Run(t *testing.T) {
+	t.Helper()
+
+	if s.New == nil || s.Item == nil {
+		t.Fatal("pipetest: Suite needs New and Item")
+	}
+	if s.Items <= 0 {
+		s.Items = ITEMS
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = TIMEOUT
+	}
+
+	t.Run("Order", s.order)
+	t.Run("ClosedInput", s.closedInput)
+	t.Run("ClosePropagates", s.closePropagates)
+	t.Run("CloseBlocked", s.closeBlocked)
+	if s.NewWithContext != nil {
+		t.Run("Cancel", s.cancel)
+	}
+}
+
+// source is the pipeline the stage reads from, it records Close
+type source[T any] struct {
+	ch     chan T
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newSource[T any]() *source[T] {
+	return &source[T]{ch: make(chan T, pipelines.CHANSIZE), closed: make(chan struct{})}
+}
+
+// PipelineChan
+func (s *source[T]) PipelineChan() chan T {
+	return s.ch
+}
+
+// Close
+func (s *source[T]) Close() {
+	s.once.Do(func() { close(s.closed) })
+}
+
+// feed sends n items to in, then closes it if closein is set.  It gives up when stop is closed
+func (s Suite[I, O]) feed(in chan I, n int, closein bool, stop <-chan struct{}) <-chan struct{} {
+	fed := make(chan struct{})
+	go func() {
+		defer func() {
+			// The stage may close its input when it shuts down
+			recover()
+		}()
+		defer func() {
+			if closein {
+				closeChan(in)
+			}
+		}()
+		defer close(fed)
+
+		for i := 0; i < n; i++ {
+			select {
+			case in <- s.Item(i):
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return fed
+}
+
+// closeChan closes c, it is ok if it is already closed
+func closeChan[T any](c chan T) {
+	defer func() { recover() }()
+	close(c)
+}
+
+// collect reads out until it is closed, false if it is not closed within the timeout
+func (s Suite[I, O]) collect(out chan O) ([]O, bool) {
+	var got []O
+	timeout := time.NewTimer(s.Timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case o, ok := <-out:
+			if !ok {
+				return got, true
+			}
+			got = append(got, o)
+		case <-timeout.C:
+			return got, false
+		}
+	}
+}
+
+// closeStage calls Close, false if it does not return within the timeout
+func (s Suite[I, O]) closeStage(t *testing.T, st pipelines.Closer) bool {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.Close()
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(s.Timeout):
+		t.Errorf("Close did not return within %v", s.Timeout)
+		return false
+	}
+}
+
+// checkDone checks the Done channel, if the stage has one, is closed
+func (s Suite[I, O]) checkDone(t *testing.T, st any) {
+	t.Helper()
+
+	d, ok := st.(interface{ Done() <-chan struct{} })
+	if !ok {
+		return
+	}
+	select {
+	case <-d.Done():
+	case <-time.After(s.Timeout):
+		t.Errorf("Done not closed within %v of Close", s.Timeout)
+	}
+}
+
+// checkLeaks waits for the goroutines to go back to base
+func (s Suite[I, O]) checkLeaks(t *testing.T, base int) {
+	t.Helper()
+
+	deadline := time.Now().Add(s.Timeout)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Errorf("goroutine leak, %v running and %v before the stage was built\n%s",
+				runtime.NumGoroutine(), base, buf)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s Suite[I, O]) order(t *testing.T) {
+	base := runtime.NumGoroutine()
+	src := newSource[I]()
+	st := s.New(src)
+
+	stop := make(chan struct{})
+	fed := s.feed(src.ch, s.Items, true, stop)
+
+	got, closed := s.collect(st.PipelineChan())
+	close(stop)
+	<-fed
+	if !closed {
+		t.Errorf("output not closed within %v of the input closing, %v items read", s.Timeout, len(got))
+	}
+	if s.Want != nil {
+		if err := s.compare(got); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if s.closeStage(t, st) {
+		s.checkDone(t, st)
+		s.checkLeaks(t, base)
+	}
+}
+
+// compare checks got against Want
+func (s Suite[I, O]) compare(got []O) error {
+	if len(got) != s.Items {
+		return fmt.Errorf("got %v items, want %v", len(got), s.Items)
+	}
+
+	if !s.Unordered {
+		for i, o := range got {
+			if w := s.Want(i); !reflect.DeepEqual(o, w) {
+				return fmt.Errorf("item %v is %v, want %v", i, o, w)
+			}
+		}
+		return nil
+	}
+
+	used := make([]bool, len(got))
+	for i := 0; i < s.Items; i++ {
+		w := s.Want(i)
+		found := false
+		for j, o := range got {
+			if !used[j] && reflect.DeepEqual(o, w) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("item %v, %v, is missing", i, w)
+		}
+	}
+	return nil
+}
+
+func (s Suite[I, O]) closedInput(t *testing.T) {
+	base := runtime.NumGoroutine()
+	src := newSource[I]()
+	st := s.New(src)
+
+	close(src.ch)
+	got, closed := s.collect(st.PipelineChan())
+	if !closed {
+		t.Errorf("output not closed within %v of the input closing", s.Timeout)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %v items from an empty input", len(got))
+	}
+
+	if s.closeStage(t, st) {
+		s.checkDone(t, st)
+		s.checkLeaks(t, base)
+	}
+}
+
+func (s Suite[I, O]) closePropagates(t *testing.T) {
+	base := runtime.NumGoroutine()
+	src := newSource[I]()
+	st := s.New(src)
+
+	// Let some items through so the stage is running
+	stop := make(chan struct{})
+	fed := s.feed(src.ch, s.Items/2, false, stop)
+	reading := make(chan struct{})
+	go func() {
+		defer close(reading)
+		for {
+			select {
+			case _, ok := <-st.PipelineChan():
+				if !ok {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-fed:
+	case <-time.After(s.Timeout):
+		t.Errorf("stage did not take %v items within %v", s.Items/2, s.Timeout)
+	}
+
+	ok := s.closeStage(t, st)
+	select {
+	case <-src.closed:
+	default:
+		t.Error("Close did not close the input pipeline")
+	}
+
+	select {
+	case <-reading:
+	case <-time.After(s.Timeout):
+		t.Errorf("output not closed within %v of Close", s.Timeout)
+	}
+	close(stop)
+	<-fed
+	<-reading
+
+	if ok {
+		s.checkDone(t, st)
+		s.checkLeaks(t, base)
+	}
+}
+
+func (s Suite[I, O]) closeBlocked(t *testing.T) {
+	base := runtime.NumGoroutine()
+	src := newSource[I]()
+	st := s.New(src)
+
+	// No one reads the output so the stage fills up and blocks
+	stop := make(chan struct{})
+	fed := s.feed(src.ch, s.Items, false, stop)
+	time.Sleep(10 * time.Millisecond)
+
+	ok := s.closeStage(t, st)
+	close(stop)
+	<-fed
+
+	if ok {
+		s.checkDone(t, st)
+		s.checkLeaks(t, base)
+	}
+}
+
+func (s Suite[I, O]) cancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan I, pipelines.CHANSIZE)
+	st := s.NewWithContext(ctx, in)
+
+	stop := make(chan struct{})
+	fed := s.feed(in, s.Items/2, false, stop)
+	out := st.PipelineChan()
+	if s.Items/2 > 0 {
+		select {
+		case <-out:
+		case <-time.After(s.Timeout):
+			t.Errorf("no output within %v", s.Timeout)
+		}
+	}
+
+	cancel()
+	if _, closed := s.collect(out); !closed {
+		t.Errorf("output not closed within %v of the context being cancelled", s.Timeout)
+	}
+	close(stop)
+	<-fed
+
+	if s.closeStage(t, st) {
+		s.checkDone(t, st)
+		s.checkLeaks(t, base)
+	}
+}
@@ -0,0 +1,57 @@
+package pipetest_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+type node struct{ key int }
+
+func (n node) Key() int { return n.key }
+
+func TestBufferPipe(t *testing.T) {
+	pipetest.Run(t, func(i int) int { return i },
+		func(in pipelines.Pipeline[int]) pipelines.Pipeline[int] {
+			b, _ := pipelines.BufferPipe[int]{}.NewWithPipeline(10, in)
+			return b
+		})
+}
+
+func TestContainerPipe(t *testing.T) {
+	pipetest.Run(t, func(i int) node { return node{key: i} },
+		func(in pipelines.Pipeline[node]) pipelines.Pipeline[node] {
+			return pipelines.ContainerPipe[int, node]{}.NewWithPipeline(in)
+		})
+}
+
+func TestConverterPipe(t *testing.T) {
+	conv := func(i int) (string, error) { return strconv.Itoa(i), nil }
+
+	pipetest.Suite[int, string]{
+		New: func(in pipelines.Pipeline[int]) pipelines.Pipeline[string] {
+			return pipelines.ConverterPipe[int, string]{}.NewWithPipeline(in, conv)
+		},
+		NewWithContext: func(ctx context.Context, in chan int) pipelines.Pipeline[string] {
+			return pipelines.ConverterPipe[int, string]{}.NewWithContext(ctx, in, conv)
+		},
+		Item: func(i int) int { return i },
+		Want: strconv.Itoa,
+	}.Run(t)
+}
+
+func TestConverterPipe_parallel(t *testing.T) {
+	conv := func(i int) (string, error) { return strconv.Itoa(i), nil }
+
+	pipetest.Suite[int, string]{
+		New: func(in pipelines.Pipeline[int]) pipelines.Pipeline[string] {
+			return pipelines.ConverterPipe[int, string]{}.NewParallelWithPipeline(4, false, in, conv)
+		},
+		Item:      func(i int) int { return i },
+		Want:      strconv.Itoa,
+		Unordered: true,
+	}.Run(t)
+}
@@ -0,0 +1,266 @@
+package pipelines
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PriorityPipe holds up to size items and sends the one with the highest priority first,
+// items with the same priority go in the order they came in.  When we are full we stop
+// reading the input until there is room.
+//
+// With Aging set an item gains one priority level for each Aging it waits, so low
+// priority items are not held forever behind a steady stream of high priority ones.
+//
+// Set the options before calling New, for example
+// PriorityPipe[T]{Priority: f, Aging: time.Second}.New(100)
+type PriorityPipe[T any] struct {
+	// Priority returns the priority of an item, higher goes first.  If nil items that
+	// are a Prioritizer use their Priority and the rest are 0
+	Priority func(t T) int
+
+	// Aging is how long an item waits to gain one priority level, 0 is no aging
+	Aging time.Duration
+
+	// Clock is used for Aging, nil is RealClock
+	Clock Clock
+
+	size int
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// prioritized is an item in the queue, seq keeps equal priorities in order
+type prioritized[T any] struct {
+	t    T
+	prio int
+	at   time.Duration
+	seq  uint64
+}
+
+// priorityQueue is a heap with the item to send next at the front
+type priorityQueue[T any] struct {
+	items []prioritized[T]
+	aging time.Duration
+}
+
+func (q *priorityQueue[T]) Len() int { return len(q.items) }
+
+func (q *priorityQueue[T]) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+// Less is true if i goes before j.  With aging an item's priority at time now is
+// prio + (now - at) / aging, now is the same for both so we can leave it out
+func (q *priorityQueue[T]) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.aging > 0 {
+		pa := float64(a.prio) - float64(a.at)/float64(q.aging)
+		pb := float64(b.prio) - float64(b.at)/float64(q.aging)
+		if pa != pb {
+			return pa > pb
+		}
+	} else if a.prio != b.prio {
+		return a.prio > b.prio
+	}
+	return a.seq < b.seq
+}
+
+func (q *priorityQueue[T]) Push(x any) { q.items = append(q.items, x.(prioritized[T])) }
+
+func (q *priorityQueue[T]) Pop() any {
+	n := len(q.items) - 1
+	it := q.items[n]
+	q.items[n] = prioritized[T]{}
+	q.items = q.items[:n]
+	return it
+}
+
+// InChan
+func (p PriorityPipe[T]) InChan() chan<- T {
+	return p.inchan
+}
+
+// OutChan
+func (p PriorityPipe[T]) OutChan() <-chan T {
+	return p.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (p PriorityPipe[T]) PipelineChan() chan T {
+	return p.outchan
+}
+
+// Close
+func (p *PriorityPipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if p.pl != nil {
+		p.pl.Close()
+	}
+
+	// Cancel our context
+	p.can()
+
+	// Wait for us to be done
+	p.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (p PriorityPipe[_]) Done() <-chan struct{} {
+	return p.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (p *PriorityPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, p.pl, p.drain, p.done, p.can, p.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (p *PriorityPipe[_]) SetMetrics(name string, m Metrics) {
+	p.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (p *PriorityPipe[_]) Stats() Stats {
+	return p.metrics.stats(p.done, len(p.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (p *PriorityPipe[_]) Upstreams() []any {
+	return upstreams(p.pl)
+}
+
+// priorityOf uses Prioritizer when we were not given a Priority func
+func priorityOf[T any](t T) int {
+	if p, ok := any(t).(Prioritizer); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+// mainloop, read from in channel while we have room and queue the items by priority,
+// write the first to the out channel.  On input close we send what we hold, exit when
+// our context is closed
+func (p *PriorityPipe[T]) mainloop() {
+	defer close(p.done)
+	defer p.wg.Done()
+	defer close(p.outchan)
+
+	queue := &priorityQueue[T]{aging: p.Aging}
+	start := p.Clock.Now()
+	var seq uint64
+
+	in := p.inchan
+	stop := p.drain.ch
+	for {
+		p.metrics.depth(queue.Len())
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && queue.Len() == 0 {
+			return
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if queue.Len() > 0 {
+			out, head = p.outchan, queue.items[0].t
+			p.metrics.sending()
+		} else {
+			p.metrics.receiving()
+		}
+
+		// Stop reading when we are full
+		read := in
+		if queue.Len() >= p.size {
+			read = nil
+		}
+
+		select {
+		case out <- head:
+			heap.Pop(queue)
+			p.metrics.out()
+		case t, ok := <-read:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			p.metrics.in()
+			heap.Push(queue, prioritized[T]{t: t, prio: p.Priority(t), at: p.Clock.Since(start), seq: seq})
+			seq++
+		case <-stop:
+			stop = nil
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p PriorityPipe[T]) NewWithChannel(size int, in chan T) (*PriorityPipe[T], error) {
+	return p.NewWithContext(context.Background(), size, in)
+}
+
+func (p PriorityPipe[T]) NewWithContext(ctx context.Context, size int, in chan T) (*PriorityPipe[T], error) {
+	if size < 1 {
+		return nil, errors.New("priority size must be >= 1")
+	}
+	if p.Aging < 0 {
+		return nil, errors.New("priority aging must be >= 0")
+	}
+
+	prio := p.Priority
+	if prio == nil {
+		prio = priorityOf[T]
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := PriorityPipe[T]{
+		Priority: prio,
+		Aging:    p.Aging,
+		Clock:    orRealClock(p.Clock),
+		size:     size,
+		ctx:      con,
+		can:      cancel,
+		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{}),
+		drain:    newSignal(),
+		metrics:  newStageMetrics(p.Clock),
+		inchan:   in,
+		outchan:  make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (p PriorityPipe[T]) NewWithPipeline(size int, pl Pipeline[T]) (*PriorityPipe[T], error) {
+	return p.NewWithPipelineContext(context.Background(), size, pl)
+}
+
+func (p PriorityPipe[T]) NewWithPipelineContext(ctx context.Context, size int, pl Pipeline[T]) (*PriorityPipe[T], error) {
+	r, err := p.NewWithContext(ctx, size, pl.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = pl
+
+	return r, nil
+}
+
+func (p PriorityPipe[T]) New(size int) (*PriorityPipe[T], error) {
+	return p.NewWithChannel(size, make(chan T, CHANSIZE))
+}
@@ -0,0 +1,71 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+type message struct {
+	prio int
+	body string
+}
+
+func (m message) Priority() int {
+	return m.prio
+}
+
+// The control message overtakes the bulk data that came in before it
+func ExamplePriorityPipe() {
+	p, _ := pipelines.PriorityPipe[message]{}.New(10)
+
+	p.InChan() <- message{prio: 0, body: "bulk 1"}
+	p.InChan() <- message{prio: 0, body: "bulk 2"}
+	p.InChan() <- message{prio: 5, body: "control"}
+
+	for i := 0; i < 3; i++ {
+		fmt.Println((<-p.OutChan()).body)
+	}
+
+	p.Close()
+	// Output:
+	// control
+	// bulk 1
+	// bulk 2
+}
+
+// After waiting 5s the bulk item has gained 5 levels and goes before a priority 3 item
+func ExamplePriorityPipe_aging() {
+	clock := pipelines.NewFakeClock(time.Time{})
+	p, _ := pipelines.PriorityPipe[message]{Aging: time.Second, Clock: clock}.New(10)
+
+	p.InChan() <- message{prio: 0, body: "bulk"}
+	for p.Stats().Held != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(5 * time.Second)
+
+	p.InChan() <- message{prio: 3, body: "urgent"}
+	p.InChan() <- message{prio: 6, body: "control"}
+
+	for i := 0; i < 3; i++ {
+		fmt.Println((<-p.OutChan()).body)
+	}
+
+	p.Close()
+	// Output:
+	// control
+	// bulk
+	// urgent
+}
+
+func TestPriorityPipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) int { return i },
+		func(in pipelines.Pipeline[int]) pipelines.Pipeline[int] {
+			p, _ := pipelines.PriorityPipe[int]{}.NewWithPipeline(10, in)
+			return p
+		})
+}
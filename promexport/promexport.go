@@ -0,0 +1,290 @@
+/*
+  Package promexport collects the metrics reported by pipeline stages and serves
+  them in the Prometheus text exposition format.
+
+  An Exporter is a pipelines.Metrics, set it on the stages with SetMetrics and
+  serve it with net/http:
+
+	exp := promexport.New("pipelines")
+	handle.SetMetrics("", exp)
+	http.Handle("/metrics", exp)
+
+  Every metric has a stage label.  Counters are items_in_total, items_out_total,
+  items_dropped_total and errors_total, queue_depth is a gauge and latency_seconds
+  is a histogram.  Gauge adds values that are read at scrape time, such as
+  ContainerPipe.ApproxSize.
+*/
+package promexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+var _ pipelines.Metrics = (*Exporter)(nil)
+
+// DefBuckets are the latency histogram bounds in seconds used by New
+var DefBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// histogram is a Prometheus histogram, counts are per bucket and not cumulative
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// gauge is read when we are scraped
+type gauge struct {
+	name  string
+	help  string
+	stage string
+	fun   func() float64
+}
+
+// counter names and help, in the order they are written
+var counters = []struct {
+	name string
+	help string
+}{
+	{"items_in_total", "Items taken from the stage input."},
+	{"items_out_total", "Items passed on by the stage."},
+	{"items_dropped_total", "Items thrown away by the stage."},
+	{"errors_total", "Items the stage failed to handle."},
+}
+
+const (
+	itemsIn = iota
+	itemsOut
+	itemsDropped
+	errorsTotal
+	numCounters
+)
+
+// Exporter holds the metrics for many stages, it is safe for concurrent use
+type Exporter struct {
+	namespace string
+	buckets   []float64
+
+	mu       sync.Mutex
+	counters [numCounters]map[string]uint64
+	depth    map[string]int
+	latency  map[string]*histogram
+	gauges   []gauge
+}
+
+// New creates an exporter, each metric name starts with namespace_
+func New(namespace string) *Exporter {
+	return NewWithBuckets(namespace, DefBuckets)
+}
+
+// NewWithBuckets creates an exporter with the given latency bounds in seconds
+func NewWithBuckets(namespace string, buckets []float64) *Exporter {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	e := &Exporter{namespace: namespace, buckets: b,
+		depth: make(map[string]int), latency: make(map[string]*histogram)}
+	for i := range e.counters {
+		e.counters[i] = make(map[string]uint64)
+	}
+	return e
+}
+
+func (e *Exporter) add(c int, stage string, n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counters[c][stage] += uint64(n)
+}
+
+// ItemIn is part of pipelines.Metrics
+func (e *Exporter) ItemIn(stage string) {
+	e.add(itemsIn, stage, 1)
+}
+
+// ItemOut is part of pipelines.Metrics
+func (e *Exporter) ItemOut(stage string) {
+	e.add(itemsOut, stage, 1)
+}
+
+// Dropped is part of pipelines.Metrics
+func (e *Exporter) Dropped(stage string, n int) {
+	e.add(itemsDropped, stage, n)
+}
+
+// Error is part of pipelines.Metrics
+func (e *Exporter) Error(stage string, _ error) {
+	e.add(errorsTotal, stage, 1)
+}
+
+// QueueDepth is part of pipelines.Metrics
+func (e *Exporter) QueueDepth(stage string, depth int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.depth[stage] = depth
+}
+
+// Latency is part of pipelines.Metrics
+func (e *Exporter) Latency(stage string, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h, ok := e.latency[stage]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(e.buckets))}
+		e.latency[stage] = h
+	}
+
+	s := d.Seconds()
+	if i := sort.SearchFloat64s(e.buckets, s); i < len(e.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += s
+}
+
+// Gauge adds a value that is read each time we are scraped, for example
+//
+//	exp.Gauge("container_size", "Items held.", "retry", func() float64 { return float64(c.ApproxSize()) })
+//
+// fun is called with no locks held by us
+func (e *Exporter) Gauge(name, help, stage string, fun func() float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.gauges = append(e.gauges, gauge{name: name, help: help, stage: stage, fun: fun})
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	// Read the gauges first so their funcs are not called with our lock held
+	e.mu.Lock()
+	gauges := append([]gauge(nil), e.gauges...)
+	e.mu.Unlock()
+
+	gvals := make([]float64, len(gauges))
+	for i, g := range gauges {
+		gvals[i] = g.fun()
+	}
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	e.mu.Lock()
+	for i, c := range counters {
+		e.writeHeader(cw, c.name, c.help, "counter")
+		for _, s := range sortedKeys(e.counters[i]) {
+			e.writeSample(cw, c.name, s, "", float64(e.counters[i][s]))
+		}
+	}
+
+	e.writeHeader(cw, "queue_depth", "Items held or waiting on the stage input.", "gauge")
+	for _, s := range sortedKeys(e.depth) {
+		e.writeSample(cw, "queue_depth", s, "", float64(e.depth[s]))
+	}
+
+	e.writeHeader(cw, "latency_seconds", "Time the stage spent on one item.", "histogram")
+	for _, s := range sortedKeys(e.latency) {
+		h := e.latency[s]
+		var cum uint64
+		for i, b := range e.buckets {
+			cum += h.counts[i]
+			e.writeSample(cw, "latency_seconds_bucket", s, formatFloat(b), float64(cum))
+		}
+		e.writeSample(cw, "latency_seconds_bucket", s, "+Inf", float64(h.count))
+		e.writeSample(cw, "latency_seconds_sum", s, "", h.sum)
+		e.writeSample(cw, "latency_seconds_count", s, "", float64(h.count))
+	}
+	e.mu.Unlock()
+
+	// Gauges with the same name are written together under one header
+	written := make(map[string]bool)
+	for i, g := range gauges {
+		if written[g.name] {
+			continue
+		}
+		written[g.name] = true
+
+		e.writeHeader(cw, g.name, g.help, "gauge")
+		for j := i; j < len(gauges); j++ {
+			if gauges[j].name == g.name {
+				e.writeSample(cw, g.name, gauges[j].stage, "", gvals[j])
+			}
+		}
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (e *Exporter) writeHeader(w *countWriter, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %v_%v %v\n", e.namespace, name, help)
+	fmt.Fprintf(w, "# TYPE %v_%v %v\n", e.namespace, name, typ)
+}
+
+func (e *Exporter) writeSample(w *countWriter, name, stage, le string, v float64) {
+	labels := `stage="` + escapeLabel(stage) + `"`
+	if le != "" {
+		labels += `,le="` + le + `"`
+	}
+	fmt.Fprintf(w, "%v_%v{%v} %v\n", e.namespace, name, labels, formatFloat(v))
+}
+
+// countWriter keeps the byte count and first error for WriteTo
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package promexport_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/promexport"
+)
+
+type node struct{ key int }
+
+func (n node) Key() int { return n.key }
+
+func Example() {
+	exp := promexport.NewWithBuckets("pipe", []float64{0.01, 1})
+
+	con := pipelines.ContainerPipe[int, node]{}.New()
+	defer con.Close()
+	con.SetMetrics("container", exp)
+	exp.Gauge("container_size", "Items in the container.", "container",
+		func() float64 { return float64(con.ApproxSize()) })
+
+	// The second 2 is a duplicate and is dropped
+	con.InChan() <- node{key: 1}
+	con.InChan() <- node{key: 2}
+	con.InChan() <- node{key: 2}
+	<-con.OutChan()
+	exp.Latency("container", 5*time.Millisecond)
+
+	srv := httptest.NewServer(exp)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	fmt.Println(resp.Header.Get("Content-Type"))
+	for _, l := range strings.Split(string(body), "\n") {
+		if l != "" && !strings.HasPrefix(l, "#") && !strings.Contains(l, "container_size") {
+			fmt.Println(l)
+		}
+	}
+	// Output:
+	// text/plain; version=0.0.4; charset=utf-8
+	// pipe_items_in_total{stage="container"} 3
+	// pipe_items_out_total{stage="container"} 1
+	// pipe_items_dropped_total{stage="container"} 1
+	// pipe_queue_depth{stage="container"} 1
+	// pipe_latency_seconds_bucket{stage="container",le="0.01"} 1
+	// pipe_latency_seconds_bucket{stage="container",le="1"} 1
+	// pipe_latency_seconds_bucket{stage="container",le="+Inf"} 1
+	// pipe_latency_seconds_sum{stage="container"} 0.005
+	// pipe_latency_seconds_count{stage="container"} 1
+}
+
+func ExampleExporter_Gauge() {
+	exp := promexport.New("pipe")
+	exp.Gauge("retry_pending", "Items waiting for an ack.", "retry", func() float64 { return 3 })
+
+	rec := httptest.NewRecorder()
+	exp.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	s := rec.Body.String()
+	fmt.Print(s[strings.Index(s, "# HELP pipe_retry_pending"):])
+	// Output:
+	// # HELP pipe_retry_pending Items waiting for an ack.
+	// # TYPE pipe_retry_pending gauge
+	// pipe_retry_pending{stage="retry"} 3
+}
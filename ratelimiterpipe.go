@@ -16,8 +16,11 @@ type RateLimiterPipe[T DataSizer] struct {
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // InChan
@@ -48,6 +51,31 @@ func (r *RateLimiterPipe[_]) Close() {
 	r.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (r RateLimiterPipe[_]) Done() <-chan struct{} {
+	return r.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (r *RateLimiterPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, r.pl, r.drain, r.done, r.can, r.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (r *RateLimiterPipe[_]) SetMetrics(name string, m Metrics) {
+	r.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (r *RateLimiterPipe[_]) Stats() Stats {
+	return r.metrics.stats(r.done, len(r.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (r *RateLimiterPipe[_]) Upstreams() []any {
+	return upstreams(r.pl)
+}
+
 func (r *RateLimiterPipe[_]) SetLimit(l rate.Limit) {
 	r.limit.SetLimit(l)
 }
@@ -57,33 +85,55 @@ func (r *RateLimiterPipe[_]) SetBurst(n int) {
 }
 
 func (r *RateLimiterPipe[_]) mainloop() {
+	defer close(r.done)
 	defer r.wg.Done()
 	defer close(r.outchan)
 
+	stop := r.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(r.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, more := <-r.inchan:
 			if !more { // if the channel is closed, then we are done
 				return
 			}
+			r.metrics.in()
+			start := r.metrics.start()
 			err := r.limit.WaitN(r.ctx, t.Size())
+			r.metrics.latency(start)
 			if err != nil {
+				r.metrics.error(err)
 				continue
 			}
+			r.metrics.sending()
 			r.outchan <- t
+			r.metrics.out()
+		case <-stop:
+			stop = nil
 		case <-r.ctx.Done():
 			return
 		}
 	}
 }
 
-func (RateLimiterPipe[T]) NewWithChannel(rLimit rate.Limit, bLimit int, in chan T) *RateLimiterPipe[T] {
-	con, cancel := context.WithCancel(context.Background())
+func (rl RateLimiterPipe[T]) NewWithChannel(rLimit rate.Limit, bLimit int, in chan T) *RateLimiterPipe[T] {
+	return rl.NewWithContext(context.Background(), rLimit, bLimit, in)
+}
+
+func (RateLimiterPipe[T]) NewWithContext(ctx context.Context, rLimit rate.Limit, bLimit int, in chan T) *RateLimiterPipe[T] {
+	con, cancel := context.WithCancel(ctx)
 	r := RateLimiterPipe[T]{
 		limit:   rate.NewLimiter(rLimit, bLimit),
 		ctx:     con,
 		can:     cancel,
 		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
 		inchan:  in,
 		outchan: make(chan T, CHANSIZE)}
 
@@ -94,7 +144,11 @@ func (RateLimiterPipe[T]) NewWithChannel(rLimit rate.Limit, bLimit int, in chan
 }
 
 func (rl RateLimiterPipe[T]) NewWithPipeline(rLimit rate.Limit, bLimit int, p Pipeline[T]) *RateLimiterPipe[T] {
-	r := rl.NewWithChannel(rLimit, bLimit, p.PipelineChan())
+	return rl.NewWithPipelineContext(context.Background(), rLimit, bLimit, p)
+}
+
+func (rl RateLimiterPipe[T]) NewWithPipelineContext(ctx context.Context, rLimit rate.Limit, bLimit int, p Pipeline[T]) *RateLimiterPipe[T] {
+	r := rl.NewWithContext(ctx, rLimit, bLimit, p.PipelineChan())
 
 	r.pl = p
 	return r
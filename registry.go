@@ -0,0 +1,418 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrUnknownStageType = errors.New("unknown stage type")
+	ErrBadParam         = errors.New("bad parameter")
+)
+
+// ParamKind is the type of a stage parameter
+type ParamKind int
+
+const (
+	PARAMSTRING   = ParamKind(1)
+	PARAMINT      = ParamKind(2)
+	PARAMFLOAT    = ParamKind(3)
+	PARAMBOOL     = ParamKind(4)
+	PARAMDURATION = ParamKind(5)
+)
+
+func (k ParamKind) String() string {
+	switch k {
+	case PARAMSTRING:
+		return "string"
+	case PARAMINT:
+		return "int"
+	case PARAMFLOAT:
+		return "float"
+	case PARAMBOOL:
+		return "bool"
+	case PARAMDURATION:
+		return "duration"
+	}
+	return fmt.Sprintf("ParamKind(%d)", int(k))
+}
+
+// ParamSpec describes one parameter a stage takes.  Default is used when
+// the parameter is not given and it is not Required
+type ParamSpec struct {
+	Name     string
+	Kind     ParamKind
+	Required bool
+	Default  any
+}
+
+// Params holds checked parameters, the values have the Go type of their kind:
+// string, int, float64, bool or time.Duration
+type Params map[string]any
+
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+func (p Params) Int(name string) int {
+	i, _ := p[name].(int)
+	return i
+}
+
+func (p Params) Float(name string) float64 {
+	f, _ := p[name].(float64)
+	return f
+}
+
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+func (p Params) Duration(name string) time.Duration {
+	d, _ := p[name].(time.Duration)
+	return d
+}
+
+// StageFactory builds one type of stage.  In is nil for a source and Out is nil for
+// a sink.  Build is given a Pipeline[In] and must return a Pipeline[Out], or for a
+// sink a Closer.  Use Register, RegisterSource or RegisterSink to fill this in.
+type StageFactory struct {
+	In     reflect.Type
+	Out    reflect.Type
+	Params []ParamSpec
+	Build  func(ctx context.Context, in any, p Params) (Closer, error)
+}
+
+// params checks raw against the specs and converts the values to their kind
+func (f StageFactory) params(raw map[string]any) (Params, error) {
+	specs := make(map[string]ParamSpec, len(f.Params))
+	for _, s := range f.Params {
+		specs[s.Name] = s
+	}
+
+	for name := range raw {
+		if _, ok := specs[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown parameter %v", ErrBadParam, name)
+		}
+	}
+
+	p := make(Params, len(f.Params))
+	for _, s := range f.Params {
+		v, ok := raw[s.Name]
+		if !ok {
+			if s.Required {
+				return nil, fmt.Errorf("%w: missing parameter %v", ErrBadParam, s.Name)
+			}
+			if s.Default == nil {
+				continue
+			}
+			v = s.Default
+		}
+
+		c, err := convertParam(s.Kind, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v wants %v: %v", ErrBadParam, s.Name, s.Kind, err)
+		}
+		p[s.Name] = c
+	}
+
+	return p, nil
+}
+
+// convertParam turns a decoded config value into the Go type for kind
+func convertParam(kind ParamKind, v any) (any, error) {
+	switch kind {
+	case PARAMSTRING:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case PARAMINT:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case int64:
+			return int(n), nil
+		case float64:
+			if n == math.Trunc(n) {
+				return int(n), nil
+			}
+		case json.Number:
+			i, err := n.Int64()
+			return int(i), err
+		}
+	case PARAMFLOAT:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case json.Number:
+			return n.Float64()
+		}
+	case PARAMBOOL:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case PARAMDURATION:
+		switch d := v.(type) {
+		case time.Duration:
+			return d, nil
+		case string:
+			return time.ParseDuration(d)
+		}
+	}
+
+	return nil, fmt.Errorf("got %v", reflect.TypeOf(v))
+}
+
+// Registry maps stage type names to factories, it is safe to use from many go routines
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]StageFactory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]StageFactory)}
+}
+
+// Add registers a factory, a later Add with the same name replaces it
+func (r *Registry) Add(name string, f StageFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = f
+}
+
+// Get returns the factory for name
+func (r *Registry) Get(name string) (StageFactory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, ok := r.factories[name]
+	if !ok {
+		return StageFactory{}, fmt.Errorf("%w: %v", ErrUnknownStageType, name)
+	}
+	return f, nil
+}
+
+// Names returns the registered names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for n := range r.factories {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Register adds a stage that reads I and writes O
+func Register[I, O any](r *Registry, name string, params []ParamSpec,
+	build func(ctx context.Context, in Pipeline[I], p Params) (Pipeline[O], error)) {
+	r.Add(name, StageFactory{In: typeOf[I](), Out: typeOf[O](), Params: params,
+		Build: func(ctx context.Context, in any, p Params) (Closer, error) {
+			o, err := build(ctx, in.(Pipeline[I]), p)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
+		}})
+}
+
+// RegisterSource adds a stage that has no input and writes O
+func RegisterSource[O any](r *Registry, name string, params []ParamSpec,
+	build func(ctx context.Context, p Params) (Pipeline[O], error)) {
+	r.Add(name, StageFactory{Out: typeOf[O](), Params: params,
+		Build: func(ctx context.Context, _ any, p Params) (Closer, error) {
+			o, err := build(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
+		}})
+}
+
+// RegisterSink adds a stage that reads I and has no output
+func RegisterSink[I any](r *Registry, name string, params []ParamSpec,
+	build func(ctx context.Context, in Pipeline[I], p Params) (Closer, error)) {
+	r.Add(name, StageFactory{In: typeOf[I](), Params: params,
+		Build: func(ctx context.Context, in any, p Params) (Closer, error) {
+			return build(ctx, in.(Pipeline[I]), p)
+		}})
+}
+
+// registerCommon adds the stages that work on any type, named kind.suffix
+func registerCommon[T any](r *Registry, suffix string) {
+	Register(r, "buffer."+suffix, []ParamSpec{
+		{Name: "size", Kind: PARAMINT, Required: true},
+		{Name: "overflow", Kind: PARAMSTRING, Default: OVERFLOWBLOCK.String()},
+		{Name: "timeout", Kind: PARAMDURATION, Default: time.Duration(0)}},
+		func(ctx context.Context, in Pipeline[T], p Params) (Pipeline[T], error) {
+			policy, err := ParseOverflowPolicy(p.String("overflow"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBadParam, err)
+			}
+			b, err := BufferPipe[T]{Policy: policy, Timeout: p.Duration("timeout")}.NewWithPipelineContext(ctx, p.Int("size"), in)
+			if err != nil {
+				return nil, err
+			}
+			return b, nil
+		})
+	Register(r, "sample."+suffix, []ParamSpec{
+		{Name: "every", Kind: PARAMINT, Default: 0},
+		{Name: "rate", Kind: PARAMFLOAT, Default: 1.0},
+		{Name: "seed", Kind: PARAMINT, Default: 0},
+		{Name: "reservoir", Kind: PARAMINT, Default: 0},
+		{Name: "window", Kind: PARAMDURATION, Default: time.Second}},
+		func(ctx context.Context, in Pipeline[T], p Params) (Pipeline[T], error) {
+			var sample func(T) bool
+			if n := p.Int("every"); n > 0 {
+				sample = EveryNth[T](n)
+			} else if rate := p.Float("rate"); rate < 1 {
+				sample = RandomSample[T](rate, int64(p.Int("seed")))
+			}
+			s, err := SamplePipe[T]{Reservoir: p.Int("reservoir"), Window: p.Duration("window"), Seed: int64(p.Int("seed"))}.NewWithPipelineContext(ctx, sample, in)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		})
+	Register(r, "log."+suffix, []ParamSpec{{Name: "name", Kind: PARAMSTRING, Default: suffix}},
+		func(ctx context.Context, in Pipeline[T], p Params) (Pipeline[T], error) {
+			return LogPipe[T]{}.NewWithPipelineContext(ctx, p.String("name"), in), nil
+		})
+	RegisterSink(r, "null."+suffix, nil,
+		func(ctx context.Context, in Pipeline[T], _ Params) (Closer, error) {
+			return NullConsumePipe[T]{}.NewWithPipelineContext(ctx, in), nil
+		})
+}
+
+// registerConvert adds a stage that changes the type with a type assertion
+func registerConvert[I, O any](r *Registry, name string) {
+	Register(r, name, nil,
+		func(ctx context.Context, in Pipeline[I], _ Params) (Pipeline[O], error) {
+			return TypeConverterPipe[I, O]{}.NewWithPipelineContext(ctx, in), nil
+		})
+}
+
+// NewDefaultRegistry returns a registry with the stages from this package.
+// The item types are Packetable (packet), DataSizer (datasizer), Dataer (dataer) and string:
+//
+//	udp              source of packet, params addr, client, chansize
+//	dirscan          source of string, params dir, scantime, chansize
+//	fileread         string to dataer
+//	filedump         sink of dataer
+//	ratelimit        datasizer to datasizer, params rate (bytes/sec), burst
+//	bytebuffer       datasizer to datasizer, params bytes, overflow, timeout
+//	spill            packet to packet, params items, dir
+//	buffer.<type>    params size, overflow (block, dropnewest, dropoldest, timeout), timeout
+//	log.<type>       params name
+//	sample.<type>    params every, rate, seed, reservoir, window
+//	null.<type>      sink that throws items away
+//	todatasizer.packet, todataer.packet, todataer.datasizer
+//
+// Callers can add their own stages to it.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+
+	RegisterSource(r, "udp", []ParamSpec{
+		{Name: "addr", Kind: PARAMSTRING, Required: true},
+		{Name: "client", Kind: PARAMBOOL, Default: false},
+		{Name: "chansize", Kind: PARAMINT, Default: 1}},
+		func(ctx context.Context, p Params) (Pipeline[Packetable], error) {
+			ct := SERVER
+			if p.Bool("client") {
+				ct = CLIENT
+			}
+			u, err := UDPPipe{}.NewWithContext(ctx, make(chan Packetable, 1), p.String("addr"), ct, p.Int("chansize"))
+			if err != nil {
+				return nil, err
+			}
+			return u, nil
+		})
+
+	RegisterSource(r, "dirscan", []ParamSpec{
+		{Name: "dir", Kind: PARAMSTRING, Required: true},
+		{Name: "scantime", Kind: PARAMDURATION, Default: time.Second},
+		{Name: "chansize", Kind: PARAMINT, Default: 1}},
+		func(ctx context.Context, p Params) (Pipeline[string], error) {
+			d, err := DirScan{}.NewWithContext(ctx, p.String("dir"), p.Duration("scantime"), p.Int("chansize"))
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		})
+
+	Register(r, "fileread", nil,
+		func(ctx context.Context, in Pipeline[string], _ Params) (Pipeline[Dataer], error) {
+			return FileReadPipe{}.NewWithPipelineContext(ctx, in), nil
+		})
+
+	RegisterSink(r, "filedump", nil,
+		func(ctx context.Context, in Pipeline[Dataer], _ Params) (Closer, error) {
+			return FileDump{}.NewWithPipelineContext(ctx, in), nil
+		})
+
+	Register(r, "ratelimit", []ParamSpec{
+		{Name: "rate", Kind: PARAMFLOAT, Required: true},
+		{Name: "burst", Kind: PARAMINT, Required: true}},
+		func(ctx context.Context, in Pipeline[DataSizer], p Params) (Pipeline[DataSizer], error) {
+			return RateLimiterPipe[DataSizer]{}.NewWithPipelineContext(ctx, rate.Limit(p.Float("rate")), p.Int("burst"), in), nil
+		})
+
+	Register(r, "bytebuffer", []ParamSpec{
+		{Name: "bytes", Kind: PARAMINT, Required: true},
+		{Name: "overflow", Kind: PARAMSTRING, Default: OVERFLOWBLOCK.String()},
+		{Name: "timeout", Kind: PARAMDURATION, Default: time.Duration(0)}},
+		func(ctx context.Context, in Pipeline[DataSizer], p Params) (Pipeline[DataSizer], error) {
+			policy, err := ParseOverflowPolicy(p.String("overflow"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBadParam, err)
+			}
+			b, err := ByteBufferPipe[DataSizer]{Policy: policy, Timeout: p.Duration("timeout")}.NewWithPipelineContext(ctx, p.Int("bytes"), in)
+			if err != nil {
+				return nil, err
+			}
+			return b, nil
+		})
+
+	Register(r, "spill", []ParamSpec{
+		{Name: "items", Kind: PARAMINT, Required: true},
+		{Name: "dir", Kind: PARAMSTRING, Default: ""}},
+		func(ctx context.Context, in Pipeline[Packetable], p Params) (Pipeline[Packetable], error) {
+			s, err := SpillPipe[Packetable]{Codec: PacketCodec{}, Dir: p.String("dir")}.NewWithPipelineContext(ctx, p.Int("items"), in)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		})
+
+	registerCommon[Packetable](r, "packet")
+	registerCommon[DataSizer](r, "datasizer")
+	registerCommon[Dataer](r, "dataer")
+	registerCommon[string](r, "string")
+
+	registerConvert[Packetable, DataSizer](r, "todatasizer.packet")
+	registerConvert[Packetable, Dataer](r, "todataer.packet")
+	registerConvert[DataSizer, Dataer](r, "todataer.datasizer")
+
+	return r
+}
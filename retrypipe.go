@@ -20,7 +20,13 @@ type RetryPipe[K comparable, T Retryable[K]] struct {
 	outchan chan T
 	ackin   chan K
 
-	wg *sync.WaitGroup
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+
+	// draining is fired when Drain starts, before the input is closed
+	draining signal
 
 	ctx context.Context
 	can context.CancelFunc
@@ -28,31 +34,37 @@ type RetryPipe[K comparable, T Retryable[K]] struct {
 	// Next one to retry
 	nextone *RetryThing[K, T]
 
+	// keys that have been sent and not acked or expired
+	pending map[K]struct{}
+
 	retrycontainer *ContainerPipe[K, RetryThing[K, T]]
 
 	pl Pipeline[T]
 
 	RetryTime  time.Duration
 	ExpireTime time.Duration
+
+	// Clock is used for the retry and expire times, nil is RealClock
+	Clock Clock
 }
 
-//
-func (r RetryPipe[_, T]) InChan() chan<- T {
+// InChan
+func (r *RetryPipe[_, T]) InChan() chan<- T {
 	return r.inchan
 }
 
-//
-func (r RetryPipe[_, T]) OutChan() <-chan T {
+// OutChan
+func (r *RetryPipe[_, T]) OutChan() <-chan T {
 	return r.outchan
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
-func (r RetryPipe[_, T]) PipelineChan() chan T {
+func (r *RetryPipe[_, T]) PipelineChan() chan T {
 	return r.outchan
 }
 
 // AckIn
-func (r RetryPipe[K, _]) AckIn() chan<- K {
+func (r *RetryPipe[K, _]) AckIn() chan<- K {
 	return r.ackin
 }
 
@@ -62,23 +74,28 @@ func (r *RetryPipe[K, _]) SetAckIn(c chan K) {
 }
 
 // chcecksendout do a safe write to the output channel
-func (r RetryPipe[K, T]) retry(o *RetryThing[K, T]) {
+func (r *RetryPipe[K, T]) retry(o *RetryThing[K, T]) {
 	defer recoverFromClosedChan()
 
 	// Check if we are expired
-	if time.Since(o.Created()) > r.ExpireTime {
+	if r.Clock.Since(o.Created()) > r.ExpireTime {
+		delete(r.pending, o.Key())
+		r.metrics.dropped(1)
+		r.metrics.depth(len(r.pending))
 		return
 	}
 
 	// Send to output channel
+	r.metrics.sending()
 	select {
 	case r.outchan <- o.Thing():
+		r.metrics.out()
 	case <-r.ctx.Done():
 		return
 	}
 
 	// Update Retry Time
-	o.LastRetry = time.Now()
+	o.LastRetry = r.Clock.Now()
 
 	select {
 	case r.retrycontainer.InChan() <- *o:
@@ -88,9 +105,13 @@ func (r RetryPipe[K, T]) retry(o *RetryThing[K, T]) {
 }
 
 // chcecksendout do a safe write to the output channel
-func (r RetryPipe[K, T]) sendAndRetry(o T) {
+func (r *RetryPipe[K, T]) sendAndRetry(o T) {
 	// Create new retry thing as this is the first time we have seen this
 	rt := RetryThing[K, T]{}.New(o.Key(), o)
+	rt.created = r.Clock.Now()
+	r.pending[o.Key()] = struct{}{}
+	r.metrics.in()
+	r.metrics.depth(len(r.pending))
 
 	// Now Send it
 	r.retry(rt)
@@ -103,45 +124,65 @@ func minDuration(a, b time.Duration) time.Duration {
 	return b
 }
 
-// mainloop
+// mainloop, a closed input stops us at once unless we are draining, then we wait
+// for what is pending to be acked or expire
 func (r *RetryPipe[_, _]) mainloop() {
+	defer close(r.done)
 	defer r.wg.Done()
 	defer close(r.outchan)
 
+	in := r.inchan
+	stop := r.drain.ch
 	for {
+		// When draining, exit once everything is acked or expired
+		if stop == nil && (in == nil || len(in) == 0) && len(r.pending) == 0 {
+			return
+		}
 
 		if r.nextone == nil {
 			select {
-			case o, ok := <-r.inchan:
+			case o, ok := <-in:
 				if !ok {
-					return
+					if !r.draining.fired() {
+						return
+					}
+					in = nil
+					break
 				}
 				r.sendAndRetry(o)
 			case a, ok := <-r.ackin:
 				if !ok {
 					return
 				}
+				delete(r.pending, a)
+				r.metrics.depth(len(r.pending))
 				r.retrycontainer.DelChan() <- a
 			case o := <-r.retrycontainer.OutChan():
 				r.nextone = &o
+			case <-stop:
+				stop = nil
 			case <-r.ctx.Done():
 				return
 			}
 		} else {
 			// So we have one to retry
-			delay := minDuration(r.ExpireTime-time.Since(r.nextone.created), r.RetryTime-time.Since(r.nextone.LastRetry))
-			retry := time.After(delay)
+			delay := minDuration(r.ExpireTime-r.Clock.Since(r.nextone.created), r.RetryTime-r.Clock.Since(r.nextone.LastRetry))
+			retry := r.Clock.NewTimer(delay)
 
 			select {
 			// Check if the current retry one nees to be send
-			case <-retry:
+			case <-retry.C():
 				r.retry(r.nextone)
 				r.nextone = nil
 
 			// Check for new incomming
-			case o, ok := <-r.inchan:
+			case o, ok := <-in:
 				if !ok {
-					return
+					if !r.draining.fired() {
+						return
+					}
+					in = nil
+					break
 				}
 				r.sendAndRetry(o)
 
@@ -154,12 +195,19 @@ func (r *RetryPipe[_, _]) mainloop() {
 				if a == r.nextone.Key() {
 					r.nextone = nil
 				}
+				delete(r.pending, a)
+				r.metrics.depth(len(r.pending))
 				r.retrycontainer.DelChan() <- a
 
+			// Check for drain
+			case <-stop:
+				stop = nil
+
 			// Check for Closed context
 			case <-r.ctx.Done():
 				return
 			}
+			retry.Stop()
 		}
 	}
 }
@@ -180,19 +228,52 @@ func (r *RetryPipe[_, _]) Close() {
 	r.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (r *RetryPipe[_, _]) Done() <-chan struct{} {
+	return r.done
+}
+
+// Drain waits for the items we have sent to be acked or expire before we shut down, see
+// Drainer.  We are told first so the input closing doesn't stop us
+func (r *RetryPipe[_, _]) Drain(ctx context.Context) error {
+	r.draining.fire()
+	return drainPipe(ctx, r.pl, r.drain, r.done, r.can, r.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (r *RetryPipe[_, _]) SetMetrics(name string, m Metrics) {
+	r.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (r *RetryPipe[_, _]) Stats() Stats {
+	return r.metrics.stats(r.done, len(r.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (r *RetryPipe[_, _]) Upstreams() []any {
+	return upstreams(r.pl)
+}
+
 // New with input channel
-func (RetryPipe[K, T]) NewWithChannel(in chan T) *RetryPipe[K, T] {
-	c, cancel := context.WithCancel(context.Background())
+func (r RetryPipe[K, T]) NewWithChannel(in chan T) *RetryPipe[K, T] {
+	return r.NewWithContext(context.Background(), in)
+}
+
+// New with context, cancelling ctx will shut us down
+func (p RetryPipe[K, T]) NewWithContext(ctx context.Context, in chan T) *RetryPipe[K, T] {
+	c, cancel := context.WithCancel(ctx)
 	oin := in
 	oout := make(chan T, CHANSIZE)
 	ain := make(chan K, CHANSIZE)
 
 	r := RetryPipe[K, T]{inchan: oin, outchan: oout, ackin: ain,
-		ctx: c, can: cancel, wg: new(sync.WaitGroup),
-		RetryTime: RETRYTIME, ExpireTime: EXPIRETIME}
+		ctx: c, can: cancel, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), draining: newSignal(),
+		metrics: newStageMetrics(p.Clock), pending: make(map[K]struct{}), RetryTime: RETRYTIME, ExpireTime: EXPIRETIME,
+		Clock: orRealClock(p.Clock)}
 
 	// Create a retry container
-	r.retrycontainer = ContainerPipe[K, RetryThing[K, T]]{}.New()
+	r.retrycontainer = ContainerPipe[K, RetryThing[K, T]]{}.NewWithContext(c, make(chan RetryThing[K, T], CHANSIZE))
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -202,7 +283,11 @@ func (RetryPipe[K, T]) NewWithChannel(in chan T) *RetryPipe[K, T] {
 
 // New with pipeline
 func (r RetryPipe[K, T]) NewWithPipeline(p Pipeline[T]) *RetryPipe[K, T] {
-	n := r.NewWithChannel(p.PipelineChan())
+	return r.NewWithPipelineContext(context.Background(), p)
+}
+
+func (r RetryPipe[K, T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T]) *RetryPipe[K, T] {
+	n := r.NewWithContext(ctx, p.PipelineChan())
 	n.pl = p
 	return n
 }
@@ -1,6 +1,7 @@
 package pipelines_test
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -101,3 +102,41 @@ func ExampleRetryPipe_Close() {
 	retry.Close()
 	// Output:
 }
+
+// Closing the input stops the pipe at once, even with items waiting for an ack
+func ExampleRetryPipe_closedinput() {
+	retry := pipelines.RetryPipe[rptKeyType, *Obj]{}.New()
+
+	retry.InChan() <- &Obj{Sn: 1}
+	fmt.Println((<-retry.OutChan()).Key())
+	close(retry.InChan())
+
+	select {
+	case <-retry.Done():
+		fmt.Println("done")
+	case <-time.After(time.Second):
+		fmt.Println("still waiting")
+	}
+	// Output:
+	// 1
+	// done
+}
+
+// Drain waits for the items that were sent to be acked
+func ExampleRetryPipe_Drain() {
+	retry := pipelines.RetryPipe[rptKeyType, *Obj]{}.New()
+
+	retry.InChan() <- &Obj{Sn: 1}
+	fmt.Println((<-retry.OutChan()).Key())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(retry.InChan())
+		retry.AckIn() <- 1
+	}()
+
+	fmt.Println(retry.Drain(context.Background()), retry.Stats().Held)
+	// Output:
+	// 1
+	// <nil> 0
+}
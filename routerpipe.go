@@ -0,0 +1,253 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// RouterPipe sends each item from its input to exactly one of its routes.
+// A route function picks the route index, anything out of range goes to the
+// default route.  Items for a route that has been closed are dropped.
+type RouterPipe[T any] struct {
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan chan T
+
+	route     func(T) int
+	routes    []*BranchPipe[T]
+	unmatched *BranchPipe[T]
+
+	// number of routes still attached, detached is the routes that have gone so
+	// each is only counted once
+	mu       *sync.Mutex
+	open     int
+	detached map[*BranchPipe[T]]bool
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+	once    *sync.Once
+}
+
+// MatchRoute returns a route function that picks the first predicate that matches,
+// if none match the item goes to the default route
+func MatchRoute[T any](preds ...func(T) bool) func(T) int {
+	return func(t T) int {
+		for i, p := range preds {
+			if p(t) {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+// KeyHashRoute returns a route function that spreads items over n routes by a hash of Key(),
+// the same key always goes to the same route.  n less than 1 is 1
+func KeyHashRoute[K comparable, T Keyer[K]](n int) func(T) int {
+	if n < 1 {
+		n = 1
+	}
+	return func(t T) int {
+		h := fnv.New64a()
+		fmt.Fprint(h, t.Key())
+		return int(h.Sum64() % uint64(n))
+	}
+}
+
+// InChan
+func (r RouterPipe[T]) InChan() chan<- T {
+	return r.inchan
+}
+
+// Route returns the i'th route, each route is a Pipeline so stages can chain off it
+func (r RouterPipe[T]) Route(i int) *BranchPipe[T] {
+	return r.routes[i]
+}
+
+// Default returns the route for items that did not match any other route
+func (r RouterPipe[T]) Default() *BranchPipe[T] {
+	return r.unmatched
+}
+
+// Close the router and the input pipeline, it is safe to call more than once
+// and is called for us when the last route is closed
+func (r *RouterPipe[_]) Close() {
+	r.once.Do(func() {
+		// If we pipelined then call Close the input pipeline
+		if r.pl != nil {
+			r.pl.Close()
+		}
+
+		// Cancel our context
+		r.can()
+
+		// Wait for us to be done
+		r.wg.Wait()
+	})
+}
+
+// Done returns a channel that is closed once we have stopped
+func (r RouterPipe[_]) Done() <-chan struct{} {
+	return r.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (r *RouterPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, r.pl, r.drain, r.done, r.can, r.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (r *RouterPipe[_]) SetMetrics(name string, m Metrics) {
+	r.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (r *RouterPipe[_]) Stats() Stats {
+	return r.metrics.stats(r.done, len(r.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (r *RouterPipe[_]) Upstreams() []any {
+	return upstreams(r.pl)
+}
+
+// detach marks b as gone and returns true if it was the last route attached
+func (r *RouterPipe[T]) detach(b *BranchPipe[T]) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.detached[b] {
+		return false
+	}
+	r.detached[b] = true
+	r.open--
+	return r.open == 0
+}
+
+// closeBranch is called by a route when it is closed, when none are left we close
+func (r *RouterPipe[T]) closeBranch(b *BranchPipe[T]) {
+	if r.detach(b) {
+		r.Close()
+	}
+}
+
+// drainBranch is called by a branch when it is drained, the last one drains us.
+// The others wait until we are done so their output is closed
+func (r *RouterPipe[T]) drainBranch(ctx context.Context, b *BranchPipe[T]) error {
+	if r.detach(b) {
+		return r.Drain(ctx)
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pick returns the route for t
+func (r *RouterPipe[T]) pick(t T) *BranchPipe[T] {
+	i := r.route(t)
+	if i < 0 || i >= len(r.routes) {
+		return r.unmatched
+	}
+	return r.routes[i]
+}
+
+// mainloop, read from in channel and write to the matching route
+// exit when our context is closed
+func (r *RouterPipe[T]) mainloop() {
+	defer close(r.done)
+	defer r.wg.Done()
+	defer func() {
+		for _, b := range r.routes {
+			close(b.outchan)
+		}
+		close(r.unmatched.outchan)
+	}()
+
+	stop := r.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(r.inchan) == 0 {
+			return
+		}
+
+		select {
+		case t, ok := <-r.inchan:
+			if !ok {
+				return
+			}
+			r.metrics.in()
+			r.metrics.sending()
+			if r.pick(t).send(t, true) {
+				r.metrics.out()
+			} else {
+				r.metrics.dropped(1)
+			}
+		case <-stop:
+			stop = nil
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// NewWithChannel creates a router with n routes plus the default route, n less than 0 is 0
+func (rp RouterPipe[T]) NewWithChannel(n int, route func(T) int, in chan T) *RouterPipe[T] {
+	return rp.NewWithContext(context.Background(), n, route, in)
+}
+
+func (RouterPipe[T]) NewWithContext(ctx context.Context, n int, route func(T) int, in chan T) *RouterPipe[T] {
+	if n < 0 {
+		n = 0
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := RouterPipe[T]{
+		ctx:      con,
+		can:      cancel,
+		route:    route,
+		mu:       new(sync.Mutex),
+		open:     n + 1,
+		detached: make(map[*BranchPipe[T]]bool),
+		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{}),
+		drain:    newSignal(),
+		metrics:  new(stageMetrics),
+		once:     new(sync.Once),
+		inchan:   in}
+
+	for i := 0; i < n; i++ {
+		r.routes = append(r.routes, newBranch[T](con, &r, CHANSIZE))
+	}
+	r.unmatched = newBranch[T](con, &r, CHANSIZE)
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r
+}
+
+func (rp RouterPipe[T]) NewWithPipeline(n int, route func(T) int, p Pipeline[T]) *RouterPipe[T] {
+	return rp.NewWithPipelineContext(context.Background(), n, route, p)
+}
+
+func (rp RouterPipe[T]) NewWithPipelineContext(ctx context.Context, n int, route func(T) int, p Pipeline[T]) *RouterPipe[T] {
+	r := rp.NewWithContext(ctx, n, route, p.PipelineChan())
+	r.pl = p
+
+	return r
+}
+
+func (rp RouterPipe[T]) New(n int, route func(T) int) *RouterPipe[T] {
+	return rp.NewWithChannel(n, route, make(chan T, CHANSIZE))
+}
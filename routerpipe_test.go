@@ -0,0 +1,85 @@
+package pipelines_test
+
+import (
+	"fmt"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleRouterPipe_New() {
+	rt := pipelines.RouterPipe[int]{}.New(2, pipelines.MatchRoute(
+		func(i int) bool { return i < 10 },
+		func(i int) bool { return i < 100 }))
+
+	go func() {
+		rt.InChan() <- 5
+		rt.InChan() <- 50
+		rt.InChan() <- 500
+	}()
+
+	fmt.Println(<-rt.Route(0).OutChan())
+	fmt.Println(<-rt.Route(1).OutChan())
+	fmt.Println(<-rt.Default().OutChan())
+
+	rt.Close()
+	// Output:
+	// 5
+	// 50
+	// 500
+}
+
+// The same key always goes to the same route
+func ExampleKeyHashRoute() {
+	route := pipelines.KeyHashRoute[int, node2](4)
+
+	fmt.Println(route(node2{key: 42}) == route(node2{key: 42}))
+	// Output:
+	// true
+}
+
+// With less than one route everything goes to route 0
+func ExampleKeyHashRoute_zero() {
+	route := pipelines.KeyHashRoute[int, node2](0)
+
+	fmt.Println(route(node2{key: 42}))
+	// Output:
+	// 0
+}
+
+// With less than zero routes there is only the default, closing it closes the router
+func ExampleRouterPipe_negative() {
+	rt := pipelines.RouterPipe[int]{}.New(-1, pipelines.MatchRoute[int]())
+
+	rt.InChan() <- 5
+	fmt.Println(<-rt.Default().OutChan())
+
+	rt.Default().Close()
+	<-rt.Done()
+	fmt.Println("closed")
+	// Output:
+	// 5
+	// closed
+}
+
+// Each route is a pipeline, closing every route closes the router
+func ExampleRouterPipe_NewWithPipeline() {
+	buf, _ := pipelines.BufferPipe[int]{}.New(1)
+	rt := pipelines.RouterPipe[int]{}.NewWithPipeline(1, pipelines.MatchRoute(
+		func(i int) bool { return i%2 == 0 }), buf)
+
+	even := pipelines.ConverterPipe[int, string]{}.NewWithPipeline(rt.Route(0),
+		func(i int) (string, error) { return fmt.Sprintf("even %v", i), nil })
+	odd := pipelines.ConverterPipe[int, string]{}.NewWithPipeline(rt.Default(),
+		func(i int) (string, error) { return fmt.Sprintf("odd %v", i), nil })
+
+	buf.InChan() <- 2
+	fmt.Println(<-even.OutChan())
+	buf.InChan() <- 3
+	fmt.Println(<-odd.OutChan())
+
+	even.Close()
+	odd.Close()
+	// Output:
+	// even 2
+	// odd 3
+}
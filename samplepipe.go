@@ -0,0 +1,326 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplePipe sends on a sample of its input, the rest are skipped and counted as dropped.
+// The sample func picks the items, see EveryNth, RandomSample and KeyHashSample, nil
+// picks them all.
+//
+// With Reservoir set the picked items are held and up to Reservoir of them, chosen at
+// random, are sent at the end of each Window, so each window sends a fair sample no
+// matter how bursty it was.  For example
+// SamplePipe[T]{Reservoir: 10, Window: time.Second}.New(nil)
+// sends 10 random items a second.
+type SamplePipe[T any] struct {
+	// Reservoir is the number of items to keep from each Window, 0 sends items as they are picked
+	Reservoir int
+	Window    time.Duration
+
+	// Seed seeds the reservoir choice, 0 seeds it from the time
+	Seed int64
+
+	// Clock is used for Window, nil is RealClock
+	Clock Clock
+
+	sample  func(T) bool
+	sampled *uint64
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// EveryNth returns a sample func that picks the first item and every n'th after it
+func EveryNth[T any](n int) func(T) bool {
+	if n < 1 {
+		n = 1
+	}
+	i := 0
+	return func(T) bool {
+		pick := i%n == 0
+		i++
+		return pick
+	}
+}
+
+// RandomSample returns a sample func that picks each item with probability p.  The same
+// seed picks the same items, 0 seeds it from the time.  It is not safe to share between pipes
+func RandomSample[T any](p float64, seed int64) func(T) bool {
+	r := newRand(seed)
+	return func(T) bool {
+		return r.Float64() < p
+	}
+}
+
+// KeyHashSample returns a sample func that picks a fraction p of the keys by a hash of
+// Key(), every item for a picked key is picked, so a key is seen whole or not at all
+func KeyHashSample[K comparable, T Keyer[K]](p float64) func(T) bool {
+	return func(t T) bool {
+		h := fnv.New64a()
+		fmt.Fprint(h, t.Key())
+		// The top 53 bits as a float in [0, 1)
+		return float64(mix64(h.Sum64())>>11)/(1<<53) < p
+	}
+}
+
+// mix64 spreads the bits of an fnv hash, its top bits change little for short keys
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// InChan
+func (s SamplePipe[T]) InChan() chan<- T {
+	return s.inchan
+}
+
+// OutChan
+func (s SamplePipe[T]) OutChan() <-chan T {
+	return s.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (s SamplePipe[T]) PipelineChan() chan T {
+	return s.outchan
+}
+
+// Close
+func (s *SamplePipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if s.pl != nil {
+		s.pl.Close()
+	}
+
+	// Cancel our context
+	s.can()
+
+	// Wait for us to be done
+	s.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (s SamplePipe[_]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Drain sends what we hold, including a part filled reservoir, before we shut down, see Drainer
+func (s *SamplePipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, s.pl, s.drain, s.done, s.can, s.wg)
+}
+
+// Sampled returns the number of items we have picked to send
+func (s *SamplePipe[_]) Sampled() uint64 {
+	return atomic.LoadUint64(s.sampled)
+}
+
+// Skipped returns the number of items we have not sent
+func (s *SamplePipe[_]) Skipped() uint64 {
+	return atomic.LoadUint64(&s.metrics.ndropped)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (s *SamplePipe[_]) SetMetrics(name string, m Metrics) {
+	s.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (s *SamplePipe[_]) Stats() Stats {
+	return s.metrics.stats(s.done, len(s.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (s *SamplePipe[_]) Upstreams() []any {
+	return upstreams(s.pl)
+}
+
+// reservoirItem is an item in the reservoir, seq puts them back in order when sent
+type reservoirItem[T any] struct {
+	t   T
+	seq int
+}
+
+// mainloop, read from in channel and send on the items that are picked.  With a
+// reservoir they are held and sent at the end of each window.  On input close we send
+// what we hold, exit when our context is closed
+func (s *SamplePipe[T]) mainloop() {
+	defer close(s.done)
+	defer s.wg.Done()
+	defer close(s.outchan)
+
+	var ready []T
+
+	// reservoir holds the picks for this window, seen is how many were picked
+	var reservoir []reservoirItem[T]
+	seen := 0
+	var rnd *rand.Rand
+	var tick <-chan time.Time
+	if s.Reservoir > 0 {
+		rnd = newRand(s.Seed)
+		ticker := s.Clock.NewTicker(s.Window)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+
+	// flush moves the reservoir to the ready queue in the order the items came in
+	flush := func() {
+		sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].seq < reservoir[j].seq })
+		for _, it := range reservoir {
+			ready = append(ready, it.t)
+		}
+		atomic.AddUint64(s.sampled, uint64(len(reservoir)))
+		reservoir, seen = reservoir[:0], 0
+	}
+
+	in := s.inchan
+	stop := s.drain.ch
+	for {
+		s.metrics.depth(len(ready) + len(reservoir))
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) {
+			flush()
+			if len(ready) == 0 {
+				return
+			}
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if len(ready) > 0 {
+			out, head = s.outchan, ready[0]
+			s.metrics.sending()
+		} else {
+			s.metrics.receiving()
+		}
+
+		// Without a reservoir we send each pick before reading the next item
+		read := in
+		if s.Reservoir == 0 && len(ready) > 0 {
+			read = nil
+		}
+
+		select {
+		case out <- head:
+			ready = popFront(ready)
+			s.metrics.out()
+		case t, ok := <-read:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			s.metrics.in()
+
+			if s.sample != nil && !s.sample(t) {
+				s.metrics.dropped(1)
+				break
+			}
+			if s.Reservoir == 0 {
+				ready = append(ready, t)
+				atomic.AddUint64(s.sampled, 1)
+				break
+			}
+
+			// Each pick this window has an equal chance of being in the reservoir
+			seen++
+			if len(reservoir) < s.Reservoir {
+				reservoir = append(reservoir, reservoirItem[T]{t: t, seq: seen})
+			} else if j := rnd.Intn(seen); j < s.Reservoir {
+				reservoir[j] = reservoirItem[T]{t: t, seq: seen}
+				s.metrics.dropped(1)
+			} else {
+				s.metrics.dropped(1)
+			}
+		case <-tick:
+			flush()
+		case <-stop:
+			stop = nil
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s SamplePipe[T]) NewWithChannel(sample func(T) bool, in chan T) (*SamplePipe[T], error) {
+	return s.NewWithContext(context.Background(), sample, in)
+}
+
+func (s SamplePipe[T]) NewWithContext(ctx context.Context, sample func(T) bool, in chan T) (*SamplePipe[T], error) {
+	if s.Reservoir < 0 {
+		return nil, errors.New("sample reservoir must be >= 0")
+	}
+	if s.Reservoir > 0 && s.Window <= 0 {
+		return nil, errors.New("sample window must be > 0 with a reservoir")
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := SamplePipe[T]{
+		Reservoir: s.Reservoir,
+		Window:    s.Window,
+		Seed:      s.Seed,
+		Clock:     orRealClock(s.Clock),
+		sample:    sample,
+		sampled:   new(uint64),
+		ctx:       con,
+		can:       cancel,
+		wg:        new(sync.WaitGroup),
+		done:      make(chan struct{}),
+		drain:     newSignal(),
+		metrics:   newStageMetrics(s.Clock),
+		inchan:    in,
+		outchan:   make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (s SamplePipe[T]) NewWithPipeline(sample func(T) bool, p Pipeline[T]) (*SamplePipe[T], error) {
+	return s.NewWithPipelineContext(context.Background(), sample, p)
+}
+
+func (s SamplePipe[T]) NewWithPipelineContext(ctx context.Context, sample func(T) bool, p Pipeline[T]) (*SamplePipe[T], error) {
+	r, err := s.NewWithContext(ctx, sample, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (s SamplePipe[T]) New(sample func(T) bool) (*SamplePipe[T], error) {
+	return s.NewWithChannel(sample, make(chan T, CHANSIZE))
+}
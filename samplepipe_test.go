@@ -0,0 +1,92 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+func ExampleSamplePipe() {
+	s, _ := pipelines.SamplePipe[int]{}.New(pipelines.EveryNth[int](3))
+
+	go func() {
+		for i := 1; i <= 10; i++ {
+			s.InChan() <- i
+		}
+		close(s.InChan())
+	}()
+
+	for i := range s.OutChan() {
+		fmt.Println(i)
+	}
+	fmt.Println(s.Sampled(), s.Skipped())
+	// Output:
+	// 1
+	// 4
+	// 7
+	// 10
+	// 4 6
+}
+
+// The same seed picks the same items each run
+func ExampleRandomSample() {
+	pick := pipelines.RandomSample[int](0.5, 1)
+
+	var picked []int
+	for i := 0; i < 10; i++ {
+		if pick(i) {
+			picked = append(picked, i)
+		}
+	}
+	fmt.Println(picked)
+	// Output:
+	// [3 4 6 7 8 9]
+}
+
+// Every reading for a sensor is picked or none are
+func ExampleKeyHashSample() {
+	pick := pipelines.KeyHashSample[string, reading](0.5)
+
+	var picked []string
+	for _, s := range []string{"s1", "s2", "s3", "s4", "s1", "s2", "s3", "s4"} {
+		if pick(reading{Sensor: s}) {
+			picked = append(picked, s)
+		}
+	}
+	fmt.Println(picked)
+	// Output:
+	// [s1 s2 s3 s1 s2 s3]
+}
+
+// Three of the ten items in the window are picked at random and sent when it ends
+func ExampleSamplePipe_reservoir() {
+	clock := pipelines.NewFakeClock(time.Time{})
+	s, _ := pipelines.SamplePipe[int]{Reservoir: 3, Window: time.Second, Seed: 1, Clock: clock}.New(nil)
+
+	for i := 1; i <= 10; i++ {
+		s.InChan() <- i
+	}
+	for s.Skipped() != 7 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Second)
+	fmt.Println(<-s.OutChan(), <-s.OutChan(), <-s.OutChan())
+	fmt.Println(s.Sampled(), s.Skipped())
+
+	s.Close()
+	// Output:
+	// 5 7 8
+	// 3 7
+}
+
+func TestSamplePipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) int { return i },
+		func(in pipelines.Pipeline[int]) pipelines.Pipeline[int] {
+			s, _ := pipelines.SamplePipe[int]{}.NewWithPipeline(nil, in)
+			return s
+		})
+}
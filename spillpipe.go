@@ -0,0 +1,428 @@
+package pipelines
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// SPILLFILESIZE is the size a spill file grows to before we start a new one
+const SPILLFILESIZE = 4 << 20
+
+// SpillPipe holds up to memItems items in memory, items that come in while it is full
+// are written to temp files and read back in order as the memory queue drains.  The input
+// is always read, so a burst does not block the stage before us or get dropped.  The
+// temp files are removed as they are read and when we stop, spilled items are not kept.
+//
+// Set the options before calling New, for example
+// SpillPipe[Packetable]{Codec: PacketCodec{}, Dir: "/var/tmp"}.New(1000)
+type SpillPipe[T Dataer] struct {
+	// Codec turns items into bytes for the files, nil is JSONCodec.  It must be
+	// set when T is an interface, PacketCodec works for Packetable
+	Codec Codec[T]
+
+	// Dir is where we make our temp dir, empty is os.TempDir
+	Dir string
+
+	// FileSize is the size a spill file grows to before we start a new one, 0 is SPILLFILESIZE
+	FileSize int64
+
+	memItems int
+	disk     *spill
+
+	// spilled is a pointer so the value receivers don't copy it while we update it
+	spilled *int64
+
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan T
+	outchan chan T
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// InChan
+func (s SpillPipe[T]) InChan() chan<- T {
+	return s.inchan
+}
+
+// OutChan
+func (s SpillPipe[T]) OutChan() <-chan T {
+	return s.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (s SpillPipe[T]) PipelineChan() chan T {
+	return s.outchan
+}
+
+// Close
+func (s *SpillPipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if s.pl != nil {
+		s.pl.Close()
+	}
+
+	// Cancel our context
+	s.can()
+
+	// Wait for us to be done
+	s.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (s SpillPipe[_]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Drain lets the items we hold, in memory and on disk, flow out before we shut down, see Drainer
+func (s *SpillPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, s.pl, s.drain, s.done, s.can, s.wg)
+}
+
+// Spilled returns the number of items we have on disk
+func (s *SpillPipe[_]) Spilled() int {
+	return int(atomic.LoadInt64(s.spilled))
+}
+
+// Dropped returns the number of items lost because they could not be written or read back
+func (s *SpillPipe[_]) Dropped() uint64 {
+	return atomic.LoadUint64(&s.metrics.ndropped)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (s *SpillPipe[_]) SetMetrics(name string, m Metrics) {
+	s.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (s *SpillPipe[_]) Stats() Stats {
+	return s.metrics.stats(s.done, len(s.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (s *SpillPipe[_]) Upstreams() []any {
+	return upstreams(s.pl)
+}
+
+// write puts t at the end of the spill files
+func (s *SpillPipe[T]) write(t T) {
+	b, err := s.Codec.Encode(t)
+	if err == nil {
+		err = s.disk.push(b)
+	}
+	if err != nil {
+		s.metrics.error(err)
+		s.metrics.dropped(1)
+	}
+}
+
+// read takes the oldest item from the spill files, ok is false if it was lost
+func (s *SpillPipe[T]) read() (t T, ok bool) {
+	b, lost, err := s.disk.pop()
+	if err != nil {
+		s.metrics.error(err)
+		s.metrics.dropped(lost)
+		return t, false
+	}
+	t, err = s.Codec.Decode(b)
+	if err != nil {
+		s.metrics.error(err)
+		s.metrics.dropped(1)
+		return t, false
+	}
+	return t, true
+}
+
+// mainloop, read from in channel and queue the items in memory, or on disk once memory
+// is full, write the oldest to the out channel.  Once anything is on disk new items go
+// there too so the order is kept.  On input close we send what we hold, exit when our
+// context is closed
+func (s *SpillPipe[T]) mainloop() {
+	defer close(s.done)
+	defer s.wg.Done()
+	defer close(s.outchan)
+	defer func() {
+		if err := s.disk.close(); err != nil {
+			s.metrics.error(err)
+		}
+	}()
+
+	var mem []T
+
+	in := s.inchan
+	stop := s.drain.ch
+	for {
+		// Move items back from disk as memory drains, they are older than anything we read since
+		for s.disk.items > 0 && len(mem) < s.memItems {
+			if t, ok := s.read(); ok {
+				mem = append(mem, t)
+			}
+		}
+		atomic.StoreInt64(s.spilled, int64(s.disk.items))
+
+		held := len(mem) + s.disk.items
+		s.metrics.depth(held)
+
+		// When draining or the input is closed, exit once everything has been sent
+		if stop == nil && (in == nil || len(in) == 0) && held == 0 {
+			return
+		}
+
+		// Only select on the output when we have something to send
+		var out chan T
+		var head T
+		if len(mem) > 0 {
+			out, head = s.outchan, mem[0]
+			s.metrics.sending()
+		} else {
+			s.metrics.receiving()
+		}
+
+		select {
+		case out <- head:
+			mem = popFront(mem)
+			s.metrics.out()
+		case t, ok := <-in:
+			if !ok {
+				in, stop = nil, nil
+				break
+			}
+			s.metrics.in()
+
+			if s.disk.items == 0 && len(mem) < s.memItems {
+				mem = append(mem, t)
+			} else {
+				s.write(t)
+			}
+		case <-stop:
+			stop = nil
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s SpillPipe[T]) NewWithChannel(memItems int, in chan T) (*SpillPipe[T], error) {
+	return s.NewWithContext(context.Background(), memItems, in)
+}
+
+func (s SpillPipe[T]) NewWithContext(ctx context.Context, memItems int, in chan T) (*SpillPipe[T], error) {
+	if memItems < 1 {
+		return nil, errors.New("spill memory items must be >= 1")
+	}
+
+	codec := s.Codec
+	if codec == nil {
+		codec = JSONCodec[T]{}
+	}
+
+	disk, err := newSpill(s.Dir, s.FileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := SpillPipe[T]{
+		Codec:    codec,
+		Dir:      s.Dir,
+		FileSize: s.FileSize,
+		memItems: memItems,
+		disk:     disk,
+		spilled:  new(int64),
+		ctx:      con,
+		can:      cancel,
+		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{}),
+		drain:    newSignal(),
+		metrics:  new(stageMetrics),
+		inchan:   in,
+		outchan:  make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (s SpillPipe[T]) NewWithPipeline(memItems int, p Pipeline[T]) (*SpillPipe[T], error) {
+	return s.NewWithPipelineContext(context.Background(), memItems, p)
+}
+
+func (s SpillPipe[T]) NewWithPipelineContext(ctx context.Context, memItems int, p Pipeline[T]) (*SpillPipe[T], error) {
+	r, err := s.NewWithContext(ctx, memItems, p.PipelineChan())
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+func (s SpillPipe[T]) New(memItems int) (*SpillPipe[T], error) {
+	return s.NewWithChannel(memItems, make(chan T, CHANSIZE))
+}
+
+// spillFile is one temp file, records are written at the end and read from the front.
+// Each record is its length then its bytes
+type spillFile struct {
+	path string
+	size int64
+
+	// w is nil once we have moved on to a newer file
+	w  *os.File
+	bw *bufio.Writer
+
+	// r is opened when we first read from the file
+	r  *os.File
+	br *bufio.Reader
+
+	// items is the number written and not read yet
+	items int
+}
+
+// spill is a FIFO of records in temp files in a dir of our own
+type spill struct {
+	dir     string
+	maxSize int64
+	files   []*spillFile
+	items   int
+}
+
+func newSpill(parent string, maxSize int64) (*spill, error) {
+	if maxSize <= 0 {
+		maxSize = SPILLFILESIZE
+	}
+	dir, err := os.MkdirTemp(parent, "spill")
+	if err != nil {
+		return nil, err
+	}
+	return &spill{dir: dir, maxSize: maxSize}, nil
+}
+
+// push writes b at the end, starting a new file when the last one is full
+func (s *spill) push(b []byte) error {
+	var f *spillFile
+	if n := len(s.files); n > 0 && s.files[n-1].w != nil && s.files[n-1].size < s.maxSize {
+		f = s.files[n-1]
+	} else {
+		if n > 0 {
+			if err := s.files[n-1].finish(); err != nil {
+				return err
+			}
+		}
+		w, err := os.CreateTemp(s.dir, "*.spill")
+		if err != nil {
+			return err
+		}
+		f = &spillFile{path: w.Name(), w: w, bw: bufio.NewWriter(w)}
+		s.files = append(s.files, f)
+	}
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(b)))
+	if _, err := f.bw.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := f.bw.Write(b); err != nil {
+		return err
+	}
+	f.size += int64(len(hdr) + len(b))
+	f.items++
+	s.items++
+	return nil
+}
+
+// pop reads the oldest record.  If the file can't be read the rest of it is thrown
+// away and lost is the number of records that went with it
+func (s *spill) pop() (b []byte, lost int, err error) {
+	f := s.files[0]
+	if err := f.read(); err != nil {
+		return nil, s.discard(), err
+	}
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(f.br, hdr[:]); err != nil {
+		return nil, s.discard(), err
+	}
+	b = make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	if _, err := io.ReadFull(f.br, b); err != nil {
+		return nil, s.discard(), err
+	}
+
+	f.items--
+	s.items--
+	if f.items == 0 {
+		s.discard()
+	}
+	return b, 0, nil
+}
+
+// discard removes the oldest file and returns the number of records it still had
+func (s *spill) discard() int {
+	f := s.files[0]
+	f.close()
+	os.Remove(f.path)
+	s.files = s.files[1:]
+	s.items -= f.items
+	return f.items
+}
+
+// close removes all the files and our dir
+func (s *spill) close() error {
+	for _, f := range s.files {
+		f.close()
+	}
+	s.files, s.items = nil, 0
+	return os.RemoveAll(s.dir)
+}
+
+// finish flushes the file and stops writing to it
+func (f *spillFile) finish() error {
+	if f.w == nil {
+		return nil
+	}
+	err := f.bw.Flush()
+	if cerr := f.w.Close(); err == nil {
+		err = cerr
+	}
+	f.w, f.bw = nil, nil
+	return err
+}
+
+// read gets the file ready to read, what we have written so far is flushed
+func (f *spillFile) read() error {
+	if f.bw != nil {
+		if err := f.bw.Flush(); err != nil {
+			return err
+		}
+	}
+	if f.r == nil {
+		r, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		f.r, f.br = r, bufio.NewReader(r)
+	}
+	return nil
+}
+
+func (f *spillFile) close() {
+	f.finish()
+	if f.r != nil {
+		f.r.Close()
+		f.r = nil
+	}
+}
@@ -0,0 +1,55 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/sterlingdevils/pipelines"
+	"github.com/sterlingdevils/pipelines/pipetest"
+)
+
+// Only two packets fit in memory, the rest wait on disk and come out in order
+func ExampleSpillPipe() {
+	dir, _ := os.MkdirTemp("", "spill")
+	defer os.RemoveAll(dir)
+
+	s, err := pipelines.SpillPipe[pipelines.Packetable]{Codec: pipelines.PacketCodec{}, Dir: dir}.New(2)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	addr := net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000}
+	for _, w := range []string{"one", "two", "three", "four", "five"} {
+		s.InChan() <- pipelines.Packet{Addr: addr, DataSlice: []byte(w)}
+	}
+
+	for i := 0; i < 5; i++ {
+		p := <-s.OutChan()
+		a := p.Address()
+		fmt.Println(a.String(), string(p.Data()))
+	}
+	s.Close()
+
+	// The spill files are removed when we stop
+	left, _ := os.ReadDir(dir)
+	fmt.Println(len(left), s.Dropped())
+	// Output:
+	// 127.0.0.1:9000 one
+	// 127.0.0.1:9000 two
+	// 127.0.0.1:9000 three
+	// 127.0.0.1:9000 four
+	// 127.0.0.1:9000 five
+	// 0 0
+}
+
+func TestSpillPipeConformance(t *testing.T) {
+	pipetest.Run(t, func(i int) pipelines.Packetable { return pipelines.Packet{DataSlice: []byte(strconv.Itoa(i))} },
+		func(in pipelines.Pipeline[pipelines.Packetable]) pipelines.Pipeline[pipelines.Packetable] {
+			s, _ := pipelines.SpillPipe[pipelines.Packetable]{Codec: pipelines.PacketCodec{}, FileSize: 64}.NewWithPipeline(5, in)
+			return s
+		})
+}
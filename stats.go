@@ -0,0 +1,113 @@
+package pipelines
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// StageState is what a stage is doing right now
+type StageState int32
+
+const (
+	// STATERECEIVING is waiting for an item on the input, this is where a stage starts
+	STATERECEIVING = StageState(0)
+	// STATEWORKING is handling an item it has taken from the input
+	STATEWORKING = StageState(1)
+	// STATESENDING is blocked writing an item to the output
+	STATESENDING = StageState(2)
+	// STATESTOPPED has finished and will not take any more items
+	STATESTOPPED = StageState(3)
+)
+
+func (s StageState) String() string {
+	switch s {
+	case STATERECEIVING:
+		return "receiving"
+	case STATEWORKING:
+		return "working"
+	case STATESENDING:
+		return "sending"
+	case STATESTOPPED:
+		return "stopped"
+	}
+	return fmt.Sprintf("StageState(%d)", int32(s))
+}
+
+// MarshalText writes the state by name so it reads well in JSON
+func (s StageState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Stats is a snapshot of a stage.  The times are zero until the first item
+type Stats struct {
+	// Name is the name given to SetMetrics, its Metrics can be nil to only set the name
+	Name string `json:"name,omitempty"`
+
+	In      uint64 `json:"in"`
+	Out     uint64 `json:"out"`
+	Dropped uint64 `json:"dropped"`
+	Errors  uint64 `json:"errors"`
+
+	// Waiting is the number of items on our input channel, Held is the number
+	// of items inside the stage such as a buffer or container
+	Waiting int `json:"waiting"`
+	Held    int `json:"held"`
+
+	LastIn  time.Time `json:"lastIn"`
+	LastOut time.Time `json:"lastOut"`
+
+	// State is what we are doing, StateSince is when we started doing it or zero
+	// if we have not changed state since we were created
+	State      StageState `json:"state"`
+	StateSince time.Time  `json:"stateSince"`
+}
+
+// StatsReporter is a stage that can give a Stats snapshot, every pipe in this package is one
+type StatsReporter interface {
+	Stats() Stats
+}
+
+func unixTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// stats builds the snapshot, waiting is the length of our input channel
+func (s *stageMetrics) stats(done <-chan struct{}, waiting int) Stats {
+	st := Stats{Waiting: waiting}
+	if s == nil {
+		return st
+	}
+
+	if h, ok := s.hook.Load().(metricsHook); ok {
+		st.Name = h.name
+	}
+	st.In = atomic.LoadUint64(&s.nin)
+	st.Out = atomic.LoadUint64(&s.nout)
+	st.Dropped = atomic.LoadUint64(&s.ndropped)
+	st.Errors = atomic.LoadUint64(&s.nerrors)
+	st.Held = int(atomic.LoadInt64(&s.held))
+	st.LastIn = unixTime(atomic.LoadInt64(&s.lastIn))
+	st.LastOut = unixTime(atomic.LoadInt64(&s.lastOut))
+	st.State = StageState(atomic.LoadInt32(&s.state))
+	st.StateSince = unixTime(atomic.LoadInt64(&s.since))
+
+	select {
+	case <-done:
+		st.State = STATESTOPPED
+	default:
+	}
+
+	return st
+}
+
+// upstreams is the Upstreams of a pipe that reads from one pipeline, pl may be nil
+func upstreams(pl Closer) []any {
+	if pl == nil {
+		return nil
+	}
+	return []any{pl}
+}
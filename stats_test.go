@@ -0,0 +1,28 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleStats() {
+	buf, _ := pipelines.BufferPipe[int]{}.New(5)
+	buf.InChan() <- 1
+	buf.InChan() <- 2
+
+	// No one is reading so the buffer is stuck sending the first item
+	for buf.Stats().State != pipelines.STATESENDING {
+		time.Sleep(time.Millisecond)
+	}
+	st := buf.Stats()
+	fmt.Println(st.In, st.Out, st.Waiting, st.State, st.LastOut.IsZero())
+
+	buf.Close()
+	<-buf.Done()
+	fmt.Println(buf.Stats().State)
+	// Output:
+	// 1 0 1 sending true
+	// stopped
+}
@@ -0,0 +1,253 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TeePolicy sets what a branch of a TeePipe does when its reader is not keeping up
+type TeePolicy int
+
+const (
+	// TEEBLOCK waits for the branch reader, every branch runs at the speed of the slowest.
+	// This is the default
+	TEEBLOCK = TeePolicy(0)
+	// TEEDROP skips the item for the branch if the reader is not ready
+	TEEDROP = TeePolicy(1)
+	// TEEBUFFER holds up to Size items for the branch, after that items are skipped
+	TEEBUFFER = TeePolicy(2)
+)
+
+// TeeConfig is the setup for one branch of a TeePipe
+type TeeConfig struct {
+	Policy TeePolicy
+	// Size of the branch output channel, only used with TEEBUFFER and must be >= 1
+	Size int
+}
+
+// check returns an error if the config can't be used
+func (c TeeConfig) check() error {
+	if c.Policy < TEEBLOCK || c.Policy > TEEBUFFER {
+		return fmt.Errorf("unknown tee policy %d", c.Policy)
+	}
+	if c.Policy == TEEBUFFER && c.Size < 1 {
+		return errors.New("tee buffer size must be >= 1")
+	}
+	return nil
+}
+
+// TeePipe sends every item from its input to all of its branches
+type TeePipe[T any] struct {
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan chan T
+
+	branches []*BranchPipe[T]
+	policies []TeePolicy
+
+	// number of branches still attached
+	mu   *sync.Mutex
+	open int
+
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+	once    *sync.Once
+}
+
+// InChan
+func (t TeePipe[T]) InChan() chan<- T {
+	return t.inchan
+}
+
+// Branch returns the i'th output, each branch is a Pipeline so stages can chain off it
+func (t TeePipe[T]) Branch(i int) *BranchPipe[T] {
+	return t.branches[i]
+}
+
+// Branches returns all of the outputs in the order they were configured
+func (t TeePipe[T]) Branches() []*BranchPipe[T] {
+	return t.branches
+}
+
+// Close the tee and the input pipeline, it is safe to call more than once
+// and is called for us when the last branch is closed
+func (t *TeePipe[_]) Close() {
+	t.once.Do(func() {
+		// If we pipelined then call Close the input pipeline
+		if t.pl != nil {
+			t.pl.Close()
+		}
+
+		// Cancel our context
+		t.can()
+
+		// Wait for us to be done
+		t.wg.Wait()
+	})
+}
+
+// Done returns a channel that is closed once we have stopped
+func (t TeePipe[_]) Done() <-chan struct{} {
+	return t.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (t *TeePipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, t.pl, t.drain, t.done, t.can, t.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (t *TeePipe[_]) SetMetrics(name string, m Metrics) {
+	t.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (t *TeePipe[_]) Stats() Stats {
+	return t.metrics.stats(t.done, len(t.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (t *TeePipe[_]) Upstreams() []any {
+	return upstreams(t.pl)
+}
+
+// closeBranch is called by a branch when it is closed, when none are left we close
+func (t *TeePipe[T]) closeBranch(b *BranchPipe[T]) {
+	t.mu.Lock()
+	t.open--
+	last := t.open == 0
+	t.mu.Unlock()
+
+	if last {
+		t.Close()
+	}
+}
+
+// drainBranch is called by a branch when it is drained, the last one drains us.
+// The others wait until we are done so their output is closed
+func (t *TeePipe[T]) drainBranch(ctx context.Context, b *BranchPipe[T]) error {
+	t.mu.Lock()
+	t.open--
+	last := t.open == 0
+	t.mu.Unlock()
+
+	if last {
+		return t.Drain(ctx)
+	}
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mainloop, read from in channel and write to every branch
+// exit when our context is closed
+func (t *TeePipe[T]) mainloop() {
+	defer close(t.done)
+	defer t.wg.Done()
+	defer func() {
+		for _, b := range t.branches {
+			close(b.outchan)
+		}
+	}()
+
+	stop := t.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(t.inchan) == 0 {
+			return
+		}
+
+		select {
+		case v, ok := <-t.inchan:
+			if !ok {
+				return
+			}
+			t.metrics.in()
+			for i, b := range t.branches {
+				t.metrics.sending()
+				if b.send(v, t.policies[i] == TEEBLOCK) {
+					t.metrics.out()
+				} else {
+					t.metrics.dropped(1)
+				}
+			}
+			if t.ctx.Err() != nil {
+				return
+			}
+		case <-stop:
+			stop = nil
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (t TeePipe[T]) NewWithChannel(in chan T, configs ...TeeConfig) (*TeePipe[T], error) {
+	return t.NewWithContext(context.Background(), in, configs...)
+}
+
+func (TeePipe[T]) NewWithContext(ctx context.Context, in chan T, configs ...TeeConfig) (*TeePipe[T], error) {
+	for _, c := range configs {
+		if err := c.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	con, cancel := context.WithCancel(ctx)
+
+	r := TeePipe[T]{
+		ctx:     con,
+		can:     cancel,
+		mu:      new(sync.Mutex),
+		open:    len(configs),
+		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
+		once:    new(sync.Once),
+		inchan:  in}
+
+	for _, c := range configs {
+		size := CHANSIZE
+		if c.Policy == TEEBUFFER {
+			size = c.Size
+		}
+		r.branches = append(r.branches, newBranch[T](con, &r, size))
+		r.policies = append(r.policies, c.Policy)
+	}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r, nil
+}
+
+func (t TeePipe[T]) NewWithPipeline(p Pipeline[T], configs ...TeeConfig) (*TeePipe[T], error) {
+	return t.NewWithPipelineContext(context.Background(), p, configs...)
+}
+
+func (t TeePipe[T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T], configs ...TeeConfig) (*TeePipe[T], error) {
+	r, err := t.NewWithContext(ctx, p.PipelineChan(), configs...)
+	if err != nil {
+		return nil, err
+	}
+
+	r.pl = p
+
+	return r, nil
+}
+
+// New creates a tee with a branch for each config, the zero TeeConfig is TEEBLOCK
+func (t TeePipe[T]) New(configs ...TeeConfig) (*TeePipe[T], error) {
+	return t.NewWithChannel(make(chan T, CHANSIZE), configs...)
+}
@@ -0,0 +1,75 @@
+package pipelines_test
+
+import (
+	"fmt"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleTeePipe_New() {
+	tee, _ := pipelines.TeePipe[int]{}.New(
+		pipelines.TeeConfig{Policy: pipelines.TEEBLOCK},
+		pipelines.TeeConfig{Policy: pipelines.TEEBUFFER, Size: 1})
+
+	tee.InChan() <- 5
+
+	fmt.Println(<-tee.Branch(0).OutChan(), <-tee.Branch(1).OutChan())
+
+	tee.Close()
+	// Output:
+	// 5 5
+}
+
+// The zero TeeConfig blocks, a buffer must hold at least one item
+func ExampleTeePipe_config() {
+	tee, _ := pipelines.TeePipe[int]{}.New(pipelines.TeeConfig{})
+	go func() { tee.InChan() <- 3 }()
+	fmt.Println(<-tee.Branch(0).OutChan())
+	tee.Close()
+
+	_, err := pipelines.TeePipe[int]{}.New(pipelines.TeeConfig{Policy: pipelines.TEEBUFFER})
+	fmt.Println(err)
+	// Output:
+	// 3
+	// tee buffer size must be >= 1
+}
+
+func ExampleTeePipe_drop() {
+	tee, _ := pipelines.TeePipe[int]{}.New(
+		pipelines.TeeConfig{Policy: pipelines.TEEBLOCK},
+		pipelines.TeeConfig{Policy: pipelines.TEEDROP})
+
+	// Nobody is reading the second branch so it will skip these
+	tee.InChan() <- 1
+	<-tee.Branch(0).OutChan()
+	tee.InChan() <- 2
+	<-tee.Branch(0).OutChan()
+
+	tee.Close()
+	fmt.Println(tee.Branch(1).Dropped())
+	// Output:
+	// 2
+}
+
+// Closing every branch closes the tee and its input pipeline once
+func ExampleTeePipe_NewWithPipeline() {
+	buf, _ := pipelines.BufferPipe[int]{}.New(1)
+	tee, _ := pipelines.TeePipe[int]{}.NewWithPipeline(buf,
+		pipelines.TeeConfig{Policy: pipelines.TEEBLOCK},
+		pipelines.TeeConfig{Policy: pipelines.TEEBLOCK})
+
+	lg := pipelines.LogPipe[int]{}.NewWithPipeline("tee", tee.Branch(0))
+	cvt := pipelines.ConverterPipe[int, string]{}.NewWithPipeline(tee.Branch(1),
+		func(i int) (string, error) {
+			return fmt.Sprintf("value %v", i), nil
+		})
+
+	buf.InChan() <- 7
+	<-lg.OutChan()
+	fmt.Println(<-cvt.OutChan())
+
+	lg.Close()
+	cvt.Close()
+	// Output:
+	// value 7
+}
@@ -6,8 +6,6 @@ import (
 )
 
 type ThrottlePipe[T any] struct {
-	tokens uint64
-
 	ctx context.Context
 	can context.CancelFunc
 
@@ -16,8 +14,11 @@ type ThrottlePipe[T any] struct {
 	inchan  chan T
 	outchan chan T
 
-	pl Pipeline[T]
-	wg *sync.WaitGroup
+	pl      Pipeline[T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // PipelineChan returns a R/W channel that is used for pipelining
@@ -59,32 +60,72 @@ func (b *ThrottlePipe[_]) Close() {
 	b.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (b ThrottlePipe[_]) Done() <-chan struct{} {
+	return b.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (b *ThrottlePipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, b.pl, b.drain, b.done, b.can, b.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (b *ThrottlePipe[_]) SetMetrics(name string, m Metrics) {
+	b.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (b *ThrottlePipe[_]) Stats() Stats {
+	return b.metrics.stats(b.done, len(b.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (b *ThrottlePipe[_]) Upstreams() []any {
+	return upstreams(b.pl)
+}
+
 // mainloop, read from in channel and write to out channel safely, log the item
 // exit when our context is closed
 func (b *ThrottlePipe[T]) mainloop() {
+	defer close(b.done)
 	defer b.wg.Done()
 	defer close(b.outchan)
 
+	// tokens lives here, not on the pipe, the value receivers copy the pipe while we run
+	var tokens uint64
+
+	stop := b.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(b.inchan) == 0 {
+			return
+		}
+
 		// If token is available
-		if b.tokens > 0 {
+		if tokens > 0 {
 			select {
 			case t, ok := <-b.inchan:
 				if !ok {
 					return
 				}
-				b.tokens--
+				b.metrics.in()
+				tokens--
+				b.metrics.sending()
 				b.outchan <- t
+				b.metrics.out()
 			case t, ok := <-b.setTok:
 				if !ok {
 					return
 				}
-				b.tokens = t
+				tokens = t
 			case t, ok := <-b.addTok:
 				if !ok {
 					return
 				}
-				b.tokens += t
+				tokens += t
+			case <-stop:
+				stop = nil
 			case <-b.ctx.Done():
 				return
 			}
@@ -95,12 +136,14 @@ func (b *ThrottlePipe[T]) mainloop() {
 				if !ok {
 					return
 				}
-				b.tokens = t
+				tokens = t
 			case t, ok := <-b.addTok:
 				if !ok {
 					return
 				}
-				b.tokens += t
+				tokens += t
+			case <-stop:
+				stop = nil
 			case <-b.ctx.Done():
 				return
 			}
@@ -108,11 +151,16 @@ func (b *ThrottlePipe[T]) mainloop() {
 	}
 }
 
-func (ThrottlePipe[T]) NewWithChannel(in chan T) *ThrottlePipe[T] {
-	con, cancel := context.WithCancel(context.Background())
-	r := ThrottlePipe[T]{tokens: 0,
+func (b ThrottlePipe[T]) NewWithChannel(in chan T) *ThrottlePipe[T] {
+	return b.NewWithContext(context.Background(), in)
+}
+
+func (ThrottlePipe[T]) NewWithContext(ctx context.Context, in chan T) *ThrottlePipe[T] {
+	con, cancel := context.WithCancel(ctx)
+	r := ThrottlePipe[T]{
 		setTok: make(chan uint64), addTok: make(chan uint64),
 		ctx: con, can: cancel, wg: new(sync.WaitGroup),
+		done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics),
 		inchan: in, outchan: make(chan T, CHANSIZE)}
 
 	r.wg.Add(1)
@@ -122,7 +170,11 @@ func (ThrottlePipe[T]) NewWithChannel(in chan T) *ThrottlePipe[T] {
 }
 
 func (b ThrottlePipe[T]) NewWithPipeline(p Pipeline[T]) *ThrottlePipe[T] {
-	r := b.NewWithChannel(p.PipelineChan())
+	return b.NewWithPipelineContext(context.Background(), p)
+}
+
+func (b ThrottlePipe[T]) NewWithPipelineContext(ctx context.Context, p Pipeline[T]) *ThrottlePipe[T] {
+	r := b.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 	return r
 }
@@ -0,0 +1,182 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Linker is a stage that can tell us the stages it reads from, every pipe in this package is one.
+// A branch links to the pipe it is a branch of
+type Linker interface {
+	Upstreams() []any
+}
+
+// TopologyNode is one stage found by WalkTopology
+type TopologyNode struct {
+	ID int `json:"id"`
+	// Name is the stage name if we know it, otherwise the type
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Stats *Stats `json:"stats,omitempty"`
+}
+
+// TopologyEdge is items flowing from one node to another
+type TopologyEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Topology is a pipeline rebuilt by following each stage to the ones it reads from
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// WalkTopology starts at the tails, the last stages of the chains, and follows Upstreams
+// back to the sources.  The nodes are ordered with the sources first.
+func WalkTopology(tails ...any) Topology {
+	return walkTopology(nil, tails...)
+}
+
+// walkTopology is WalkTopology with names for the stages we know
+func walkTopology(names map[any]string, tails ...any) Topology {
+	t, _ := walk(names, tails...)
+	return t
+}
+
+// walk does the work for walkTopology, it also returns the stages indexed by node ID
+func walk(names map[any]string, tails ...any) (Topology, []any) {
+	var found []any
+	ids := make(map[any]int)
+
+	// id returns the index of s in found, adding it if it is new
+	id := func(s any) (int, bool) {
+		if !reflect.TypeOf(s).Comparable() {
+			found = append(found, s)
+			return len(found) - 1, true
+		}
+		if i, ok := ids[s]; ok {
+			return i, false
+		}
+		found = append(found, s)
+		ids[s] = len(found) - 1
+		return len(found) - 1, true
+	}
+
+	var edges []TopologyEdge
+	var queue []int
+	for _, t := range tails {
+		if t == nil {
+			continue
+		}
+		if i, added := id(t); added {
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+
+		l, ok := found[i].(Linker)
+		if !ok {
+			continue
+		}
+		for _, up := range l.Upstreams() {
+			if up == nil {
+				continue
+			}
+			j, added := id(up)
+			if added {
+				queue = append(queue, j)
+			}
+			edges = append(edges, TopologyEdge{From: j, To: i})
+		}
+	}
+
+	// Reverse so the sources are first
+	n := len(found)
+	t := Topology{Nodes: make([]TopologyNode, n), Edges: make([]TopologyEdge, 0, len(edges))}
+	stages := make([]any, n)
+	for i, s := range found {
+		stages[n-1-i] = s
+		node := TopologyNode{ID: n - 1 - i, Type: strings.TrimPrefix(fmt.Sprintf("%T", s), "*")}
+		if sr, ok := s.(StatsReporter); ok {
+			st := sr.Stats()
+			node.Stats = &st
+			node.Name = st.Name
+		}
+		if node.Name == "" && reflect.TypeOf(s).Comparable() {
+			node.Name = names[s]
+		}
+		if node.Name == "" {
+			node.Name = node.Type
+		}
+		t.Nodes[node.ID] = node
+	}
+	for i := len(edges) - 1; i >= 0; i-- {
+		t.Edges = append(t.Edges, TopologyEdge{From: n - 1 - edges[i].From, To: n - 1 - edges[i].To})
+	}
+
+	return t, stages
+}
+
+// DOT returns the topology as a Graphviz digraph
+func (t Topology) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph pipeline {\n\trankdir=LR;\n")
+	for _, n := range t.Nodes {
+		label := n.Name
+		if n.Name != n.Type {
+			label += "\n" + n.Type
+		}
+		if n.Stats != nil {
+			label += fmt.Sprintf("\n%v in=%v out=%v", n.Stats.State, n.Stats.In, n.Stats.Out)
+		}
+		fmt.Fprintf(&b, "\tn%v [label=%q];\n", n.ID, label)
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&b, "\tn%v -> n%v;\n", e.From, e.To)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// JSON returns the topology as a JSON document
+func (t Topology) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+// Topology walks the chain from its last stage, stages are named as they were added
+func (h *Handle) Topology() Topology {
+	return walkTopology(stageNames(h.stages.byname), h.tail)
+}
+
+// Topology walks each chain of the graph, stages are named as they are in the config
+func (g *Graph) Topology() Topology {
+	stages := make(map[string]any, len(g.stages))
+	for n, s := range g.stages {
+		stages[n] = s
+	}
+
+	tails := make([]any, 0, len(g.tails))
+	for _, t := range g.tails {
+		tails = append(tails, t)
+	}
+	return walkTopology(stageNames(stages), tails...)
+}
+
+// stageNames turns a name to stage map around
+func stageNames(stages map[string]any) map[any]string {
+	names := make(map[any]string, len(stages))
+	for n, s := range stages {
+		if s != nil && reflect.TypeOf(s).Comparable() {
+			names[s] = n
+		}
+	}
+	return names
+}
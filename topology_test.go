@@ -0,0 +1,54 @@
+package pipelines_test
+
+import (
+	"fmt"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleHandle_Topology() {
+	h, _, err := pipelines.From[int]("throttle", pipelines.ThrottlePipe[int]{}.New()).
+		Then("log", pipelines.Wrap[int, int](func(p pipelines.Pipeline[int]) *pipelines.LogPipe[int] {
+			return pipelines.LogPipe[int]{}.NewWithPipeline("topology", p)
+		})).
+		Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer h.Close()
+
+	fmt.Print(h.Topology().DOT())
+	// Output:
+	// digraph pipeline {
+	// 	rankdir=LR;
+	// 	n0 [label="throttle\npipelines.ThrottlePipe[int]\nreceiving in=0 out=0"];
+	// 	n1 [label="log\npipelines.LogPipe[int]\nreceiving in=0 out=0"];
+	// 	n0 -> n1;
+	// }
+}
+
+func ExampleWalkTopology() {
+	tee, _ := pipelines.TeePipe[int]{}.New(pipelines.TeeConfig{}, pipelines.TeeConfig{})
+	tee.SetMetrics("tee", nil)
+	merge := pipelines.MergePipe[int]{}.NewWithPipeline(
+		[]pipelines.Pipeline[int]{tee.Branch(0), tee.Branch(1)})
+	defer merge.Close()
+
+	t := pipelines.WalkTopology(merge)
+	for _, n := range t.Nodes {
+		fmt.Println(n.ID, n.Name)
+	}
+	for _, e := range t.Edges {
+		fmt.Println(e.From, "->", e.To)
+	}
+	// Output:
+	// 0 tee
+	// 1 pipelines.BranchPipe[int]
+	// 2 pipelines.BranchPipe[int]
+	// 3 pipelines.MergePipe[int]
+	// 0 -> 1
+	// 0 -> 2
+	// 1 -> 3
+	// 2 -> 3
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 type TypeConverterPipe[I any, O any] struct {
@@ -13,8 +14,15 @@ type TypeConverterPipe[I any, O any] struct {
 	inchan  chan I
 	outchan chan O
 
-	pl Pipeline[I]
-	wg *sync.WaitGroup
+	// errors are only sent once someone asks for them
+	errs   *BranchPipe[ConvertError[I]]
+	errson int32
+
+	pl      Pipeline[I]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // InChan
@@ -32,6 +40,40 @@ func (c TypeConverterPipe[_, O]) PipelineChan() chan O {
 	return c.outchan
 }
 
+// ErrChan returns a channel with every input that failed to convert.
+// Once this is called failures must be read or the pipe will block.
+func (c *TypeConverterPipe[I, _]) ErrChan() <-chan ConvertError[I] {
+	atomic.StoreInt32(&c.errson, 1)
+	return c.errs.OutChan()
+}
+
+// ErrPipeline returns the failures as a Pipeline so a dead letter chain can be added,
+// closing it stops the failures being sent
+func (c *TypeConverterPipe[I, _]) ErrPipeline() *BranchPipe[ConvertError[I]] {
+	atomic.StoreInt32(&c.errson, 1)
+	return c.errs
+}
+
+// closeBranch is called when the error pipeline is closed
+func (c *TypeConverterPipe[I, _]) closeBranch(*BranchPipe[ConvertError[I]]) {
+	atomic.StoreInt32(&c.errson, 0)
+}
+
+// drainBranch is called when the error pipeline is drained, it is the same as closing it
+func (c *TypeConverterPipe[I, _]) drainBranch(context.Context, *BranchPipe[ConvertError[I]]) error {
+	atomic.StoreInt32(&c.errson, 0)
+	return nil
+}
+
+// fail sends the input and error to the error channel if anyone is listening
+func (c *TypeConverterPipe[I, _]) fail(t I, err error) {
+	c.metrics.error(err)
+	if atomic.LoadInt32(&c.errson) == 0 {
+		return
+	}
+	c.errs.send(ConvertError[I]{Input: t, Err: err}, true)
+}
+
 // Close
 func (c *TypeConverterPipe[_, _]) Close() {
 	// If we pipelined then call Close the input pipeline
@@ -46,6 +88,31 @@ func (c *TypeConverterPipe[_, _]) Close() {
 	c.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (c TypeConverterPipe[_, _]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (c *TypeConverterPipe[_, _]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, c.pl, c.drain, c.done, c.can, c.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (c *TypeConverterPipe[_, _]) SetMetrics(name string, m Metrics) {
+	c.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (c *TypeConverterPipe[_, _]) Stats() Stats {
+	return c.metrics.stats(c.done, len(c.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (c *TypeConverterPipe[_, _]) Upstreams() []any {
+	return upstreams(c.pl)
+}
+
 func (c *TypeConverterPipe[I, O]) convert(i I) (O, error) {
 	var p any = i
 	v, ok := p.(O)
@@ -60,39 +127,61 @@ func (c *TypeConverterPipe[I, O]) convert(i I) (O, error) {
 // mainloop, read from in channel and write to out channel safely
 // exit when our context is closed
 func (c *TypeConverterPipe[I, O]) mainloop() {
+	defer close(c.done)
 	defer c.wg.Done()
 	defer close(c.outchan)
+	defer close(c.errs.outchan)
 
+	stop := c.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(c.inchan) == 0 {
+			return
+		}
+
 		select {
 		case t, ok := <-c.inchan:
 			if !ok {
 				return
 			}
+			c.metrics.in()
 			v, err := c.convert(t)
 			if err != nil {
+				c.fail(t, err)
 				break
 			}
+			c.metrics.sending()
 			select {
 			case c.outchan <- v:
+				c.metrics.out()
 			case <-c.ctx.Done():
 				return
 			}
+		case <-stop:
+			stop = nil
 		case <-c.ctx.Done():
 			return
 		}
 	}
 }
 
-func (TypeConverterPipe[I, O]) NewWithChannel(in chan I) *TypeConverterPipe[I, O] {
-	con, cancel := context.WithCancel(context.Background())
+func (t TypeConverterPipe[I, O]) NewWithChannel(in chan I) *TypeConverterPipe[I, O] {
+	return t.NewWithContext(context.Background(), in)
+}
+
+func (TypeConverterPipe[I, O]) NewWithContext(ctx context.Context, in chan I) *TypeConverterPipe[I, O] {
+	con, cancel := context.WithCancel(ctx)
 
 	r := TypeConverterPipe[I, O]{
 		ctx:     con,
 		can:     cancel,
 		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
 		inchan:  in,
 		outchan: make(chan O, CHANSIZE)}
+	r.errs = newBranch[ConvertError[I]](con, &r, CHANSIZE)
 
 	r.wg.Add(1)
 	go r.mainloop()
@@ -101,7 +190,11 @@ func (TypeConverterPipe[I, O]) NewWithChannel(in chan I) *TypeConverterPipe[I, O
 }
 
 func (t TypeConverterPipe[I, O]) NewWithPipeline(p Pipeline[I]) *TypeConverterPipe[I, O] {
-	r := t.NewWithChannel(p.PipelineChan())
+	return t.NewWithPipelineContext(context.Background(), p)
+}
+
+func (t TypeConverterPipe[I, O]) NewWithPipelineContext(ctx context.Context, p Pipeline[I]) *TypeConverterPipe[I, O] {
+	r := t.NewWithContext(ctx, p.PipelineChan())
 	r.pl = p
 
 	return r
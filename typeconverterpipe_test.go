@@ -28,3 +28,19 @@ func ExampleTypeConverterPipe() {
 	// Output:
 	// 2 pipelines_test.tctA
 }
+
+func ExampleTypeConverterPipe_ErrChan() {
+	cvt := pipelines.TypeConverterPipe[any, int]{}.New()
+	errs := cvt.ErrChan()
+
+	go func() {
+		cvt.InChan() <- "not an int"
+	}()
+
+	e := <-errs
+	fmt.Println(e.Input)
+
+	cvt.Close()
+	// Output:
+	// not an int
+}
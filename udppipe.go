@@ -66,16 +66,21 @@ type UDPPipe struct {
 
 	ct ConnType
 
-	pl Pipeline[Packetable]
-	wg *sync.WaitGroup
+	pl      Pipeline[Packetable]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
 }
 
 // protectChanWrite sends to a channel with a context cancel to
 // exit on contect close even if the write to channel is blocked
 func (u *UDPPipe) protectChanWrite(t Packet) {
 	defer recoverFromClosedChan()
+	u.metrics.sending()
 	select {
 	case u.outchan <- t:
+		u.metrics.out()
 	case <-u.ctx.Done():
 	}
 }
@@ -119,11 +124,21 @@ func (u *UDPPipe) processInUDP() {
 			return
 		}
 
+		// Check if we are draining, we stop reading the socket
+		select {
+		case <-u.drain.ch:
+			return
+		default:
+		}
+
 		buf := make([]byte, MaxPacketSize)
 		u.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
 
 		n, a, err := u.conn.ReadFromUDP(buf)
 		if err != nil {
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				u.metrics.error(err)
+			}
 			continue
 		}
 
@@ -140,37 +155,64 @@ func (u *UDPPipe) processInChan() {
 	send := func(p Packetable) {
 		if len(p.Data()) > MaxPacketSize {
 			log.Printf("packet size exceeds max: %v\n", len(p.Data()))
+			u.metrics.dropped(1)
 			return
 		}
+		start := u.metrics.start()
 		switch u.ct {
 		case SERVER:
 			a := p.Address()
 			_, err := u.conn.WriteToUDP(p.Data(), &a)
 			if err != nil {
 				log.Println("udp write failed")
+				u.metrics.error(err)
 			}
 		case CLIENT:
 			_, err := u.conn.Write(p.Data())
 			if err != nil {
 				log.Println("udp write failed")
+				u.metrics.error(err)
 			}
 		}
+		u.metrics.latency(start)
 	}
 
 	// wait for packets on the input channel or the context to close
+	stop := u.drain.ch
 	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(u.inchan) == 0 {
+			return
+		}
+
 		select {
 		case b, more := <-u.inchan:
 			if !more { // if the channel is closed, then we are done
 				return
 			}
+			u.metrics.in()
 			send(b)
+			u.metrics.receiving()
+		case <-stop:
+			stop = nil
 		case <-u.ctx.Done():
 			return
 		}
 	}
 }
 
+// waitDone closes the socket and output channel once our routines have finished
+func (u *UDPPipe) waitDone() {
+	u.wg.Wait()
+
+	u.once.Do(func() {
+		u.conn.Close()
+		close(u.outchan)
+	})
+
+	close(u.done)
+}
+
 // ------------------------------------------------------------------------------------
 // Public Methods
 // ------------------------------------------------------------------------------------
@@ -208,6 +250,31 @@ func (u *UDPPipe) Close() {
 	u.wg.Wait()
 }
 
+// Done returns a channel that is closed once we have stopped
+func (u UDPPipe) Done() <-chan struct{} {
+	return u.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (u *UDPPipe) Drain(ctx context.Context) error {
+	return drainPipe(ctx, u.pl, u.drain, u.done, u.can, u.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (u *UDPPipe) SetMetrics(name string, m Metrics) {
+	u.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (u *UDPPipe) Stats() Stats {
+	return u.metrics.stats(u.done, len(u.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (u *UDPPipe) Upstreams() []any {
+	return upstreams(u.pl)
+}
+
 // ------------------------------------------------------------------------------------
 // New Functions to create a UDP
 // ------------------------------------------------------------------------------------
@@ -224,9 +291,14 @@ func (u *UDPPipe) Close() {
 //  NOTE:
 //    The input channel we will not close, we assume we do not own it
 func (u UDPPipe) NewWithParams(in1 chan Packetable, addr string, ct ConnType, outChanSize int) (*UDPPipe, error) {
-	c, cancel := context.WithCancel(context.Background())
+	return u.NewWithContext(context.Background(), in1, addr, ct, outChanSize)
+}
+
+// NewWithContext is NewWithParams with a parent context, cancelling ctx will shutdown the socket
+func (UDPPipe) NewWithContext(ctx context.Context, in1 chan Packetable, addr string, ct ConnType, outChanSize int) (*UDPPipe, error) {
+	c, cancel := context.WithCancel(ctx)
 	udp := UDPPipe{outchan: make(chan Packetable, outChanSize), addr: addr, inchan: in1, ct: ct,
-		ctx: c, can: cancel, wg: new(sync.WaitGroup), once: new(sync.Once)}
+		ctx: c, can: cancel, wg: new(sync.WaitGroup), done: make(chan struct{}), drain: newSignal(), metrics: new(stageMetrics), once: new(sync.Once)}
 
 	if err := udp.startConn(); err != nil {
 		return nil, err
@@ -238,6 +310,8 @@ func (u UDPPipe) NewWithParams(in1 chan Packetable, addr string, ct ConnType, ou
 	udp.wg.Add(1)
 	go udp.processInChan()
 
+	go udp.waitDone()
+
 	return &udp, nil
 }
 
@@ -254,10 +328,16 @@ func (u UDPPipe) NewWithChan(port int, in chan Packetable) (*UDPPipe, error) {
 
 // NewWithPipeline takes a pipelineable
 func (u UDPPipe) NewWithPipeline(port int, p Pipeline[Packetable]) (*UDPPipe, error) {
+	return u.NewWithPipelineContext(context.Background(), port, p)
+}
+
+// NewWithPipelineContext takes a pipelineable, cancelling ctx will close us
+// It will always setup a SERVER mode component
+func (u UDPPipe) NewWithPipelineContext(ctx context.Context, port int, p Pipeline[Packetable]) (*UDPPipe, error) {
 	if p == nil {
 		return nil, errors.New("bad pipeline passed in to New")
 	}
-	udpc, err := u.NewWithChan(port, p.PipelineChan())
+	udpc, err := u.NewWithContext(ctx, p.PipelineChan(), fmt.Sprintf(":%v", port), SERVER, 1)
 	if err != nil {
 		return nil, err
 	}
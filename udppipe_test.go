@@ -2,6 +2,7 @@
 package pipelines_test
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -64,3 +65,20 @@ func ExampleUDPPipe_New() {
 
 	// Output: {127.0.0.1 9092 }: [72 101 108 108 111 32 102 114 111 109 32 85 115 46]
 }
+
+func ExampleUDPPipe_NewWithContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	udpcomp, err := pipelines.UDPPipe{}.NewWithContext(ctx, make(chan pipelines.Packetable), ":9093", pipelines.SERVER, 1)
+	if err != nil {
+		log.Fatalln("error creating UDP")
+	}
+
+	cancel()
+	<-udpcomp.Done()
+
+	_, ok := <-udpcomp.OutChan()
+	fmt.Println(ok)
+
+	// Output: false
+}
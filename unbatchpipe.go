@@ -0,0 +1,151 @@
+package pipelines
+
+import (
+	"context"
+	"sync"
+)
+
+// UnbatchPipe takes slices of items and outputs the items one at a time, it undoes a BatchPipe
+type UnbatchPipe[T any] struct {
+	ctx context.Context
+	can context.CancelFunc
+
+	inchan  chan []T
+	outchan chan T
+
+	pl      Pipeline[[]T]
+	wg      *sync.WaitGroup
+	done    chan struct{}
+	drain   signal
+	metrics *stageMetrics
+}
+
+// InChan
+func (u UnbatchPipe[T]) InChan() chan<- []T {
+	return u.inchan
+}
+
+// OutChan
+func (u UnbatchPipe[T]) OutChan() <-chan T {
+	return u.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (u UnbatchPipe[T]) PipelineChan() chan T {
+	return u.outchan
+}
+
+// Close
+func (u *UnbatchPipe[_]) Close() {
+	// If we pipelined then call Close the input pipeline
+	if u.pl != nil {
+		u.pl.Close()
+	}
+
+	// Cancel our context
+	u.can()
+
+	// Wait for us to be done
+	u.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (u UnbatchPipe[_]) Done() <-chan struct{} {
+	return u.done
+}
+
+// Drain lets the items we hold flow out before we shut down, see Drainer
+func (u *UnbatchPipe[_]) Drain(ctx context.Context) error {
+	return drainPipe(ctx, u.pl, u.drain, u.done, u.can, u.wg)
+}
+
+// SetMetrics reports our metrics to m labeled with name, see Metrics
+func (u *UnbatchPipe[_]) SetMetrics(name string, m Metrics) {
+	u.metrics.set(name, m)
+}
+
+// Stats returns a snapshot of what we are doing, see Stats
+func (u *UnbatchPipe[_]) Stats() Stats {
+	return u.metrics.stats(u.done, len(u.inchan))
+}
+
+// Upstreams returns the pipeline we read from
+func (u *UnbatchPipe[_]) Upstreams() []any {
+	return upstreams(u.pl)
+}
+
+// mainloop, read a slice from in channel and write each item to out channel safely
+// exit when our context is closed
+func (u *UnbatchPipe[_]) mainloop() {
+	defer close(u.done)
+	defer u.wg.Done()
+	defer close(u.outchan)
+
+	stop := u.drain.ch
+	for {
+		// When draining, exit once the input is empty
+		if stop == nil && len(u.inchan) == 0 {
+			return
+		}
+
+		select {
+		case ts, ok := <-u.inchan:
+			if !ok {
+				return
+			}
+			u.metrics.in()
+			for _, t := range ts {
+				u.metrics.sending()
+				select {
+				case u.outchan <- t:
+					u.metrics.out()
+				case <-u.ctx.Done():
+					return
+				}
+			}
+			u.metrics.receiving()
+		case <-stop:
+			stop = nil
+		case <-u.ctx.Done():
+			return
+		}
+	}
+}
+
+func (u UnbatchPipe[T]) NewWithChannel(in chan []T) *UnbatchPipe[T] {
+	return u.NewWithContext(context.Background(), in)
+}
+
+func (UnbatchPipe[T]) NewWithContext(ctx context.Context, in chan []T) *UnbatchPipe[T] {
+	con, cancel := context.WithCancel(ctx)
+
+	r := UnbatchPipe[T]{
+		ctx:     con,
+		can:     cancel,
+		wg:      new(sync.WaitGroup),
+		done:    make(chan struct{}),
+		drain:   newSignal(),
+		metrics: new(stageMetrics),
+		inchan:  in,
+		outchan: make(chan T, CHANSIZE)}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r
+}
+
+func (u UnbatchPipe[T]) NewWithPipeline(p Pipeline[[]T]) *UnbatchPipe[T] {
+	return u.NewWithPipelineContext(context.Background(), p)
+}
+
+func (u UnbatchPipe[T]) NewWithPipelineContext(ctx context.Context, p Pipeline[[]T]) *UnbatchPipe[T] {
+	r := u.NewWithContext(ctx, p.PipelineChan())
+	r.pl = p
+
+	return r
+}
+
+func (u UnbatchPipe[T]) New() *UnbatchPipe[T] {
+	return u.NewWithChannel(make(chan []T, CHANSIZE))
+}
@@ -0,0 +1,262 @@
+package pipelines
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SEGMENTSIZE is the size a log segment grows to before we start a new one
+	SEGMENTSIZE = 16 << 20
+
+	segmentExt = ".seg"
+
+	// Record types, an ack record has no payload and the seq of the item it acks
+	recordItem = byte(1)
+	recordAck  = byte(2)
+
+	// type, seq, payload length, crc
+	recordHeader = 1 + 8 + 4 + 4
+)
+
+// ErrCorruptRecord is a log record that failed its checksum or is cut short,
+// we stop reading the segment at the first one
+var ErrCorruptRecord = errors.New("corrupt log record")
+
+// walItem is an item record that has not been acked
+type walItem struct {
+	seq     uint64
+	payload []byte
+}
+
+// segment is one file of the log, they are numbered in the order they are written
+type segment struct {
+	num  uint64
+	path string
+	size int64
+	// live is the number of items in the segment that have not been acked
+	live int
+}
+
+// wal is a write ahead log split into segments.  Items are appended and later acked,
+// segments are removed from the front once all their items are acked.  Acks are
+// always written after their item, so removing only from the front means an ack
+// is never lost while its item is still on disk.
+type wal struct {
+	dir     string
+	maxSize int64
+	sync    bool
+
+	segs []*segment
+	f    *os.File
+	next uint64
+
+	// owner is the segment of each item that has not been acked
+	owner map[uint64]*segment
+}
+
+// openWAL reads the segments in dir and returns the items that were not acked in
+// order.  A corrupt record, such as one cut short by a crash, ends its segment.
+// We always start a new segment for writing.
+func openWAL(dir string, maxSize int64, sync bool) (*wal, []walItem, error) {
+	if maxSize <= 0 {
+		maxSize = SEGMENTSIZE
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	w := &wal{dir: dir, maxSize: maxSize, sync: sync, owner: make(map[uint64]*segment)}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := make(map[uint64]walItem)
+	for _, name := range names {
+		num, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segs = append(w.segs, &segment{num: num, path: name})
+	}
+	sort.Slice(w.segs, func(i, j int) bool { return w.segs[i].num < w.segs[j].num })
+
+	for _, s := range w.segs {
+		err := readSegment(s.path, func(typ byte, seq uint64, payload []byte) {
+			if seq >= w.next {
+				w.next = seq + 1
+			}
+			switch typ {
+			case recordItem:
+				items[seq] = walItem{seq: seq, payload: payload}
+				w.owner[seq] = s
+				s.live++
+			case recordAck:
+				if o, ok := w.owner[seq]; ok {
+					o.live--
+					delete(w.owner, seq)
+					delete(items, seq)
+				}
+			}
+		})
+		if err != nil && !errors.Is(err, ErrCorruptRecord) {
+			return nil, nil, err
+		}
+	}
+
+	if err := w.roll(); err != nil {
+		w.close()
+		return nil, nil, err
+	}
+
+	left := make([]walItem, 0, len(items))
+	for _, it := range items {
+		left = append(left, it)
+	}
+	sort.Slice(left, func(i, j int) bool { return left[i].seq < left[j].seq })
+
+	return w, left, nil
+}
+
+// readSegment calls fun for each good record in the file
+func readSegment(path string, fun func(typ byte, seq uint64, payload []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		if len(data) < recordHeader {
+			return ErrCorruptRecord
+		}
+		n := int(binary.BigEndian.Uint32(data[9:13]))
+		if len(data) < recordHeader+n {
+			return ErrCorruptRecord
+		}
+		sum := crc32.ChecksumIEEE(data[:13])
+		sum = crc32.Update(sum, crc32.IEEETable, data[recordHeader:recordHeader+n])
+		if sum != binary.BigEndian.Uint32(data[13:17]) {
+			return ErrCorruptRecord
+		}
+
+		fun(data[0], binary.BigEndian.Uint64(data[1:9]), data[recordHeader:recordHeader+n])
+		data = data[recordHeader+n:]
+	}
+	return nil
+}
+
+// roll closes the current segment and starts a new one
+func (w *wal) roll() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+
+	num := uint64(0)
+	if n := len(w.segs); n > 0 {
+		num = w.segs[n-1].num + 1
+	}
+	s := &segment{num: num, path: filepath.Join(w.dir, fmt.Sprintf("%020d%v", num, segmentExt))}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.segs = append(w.segs, s)
+
+	return w.trim()
+}
+
+// trim removes the segments at the front that have no live items, never the one we write to
+func (w *wal) trim() error {
+	for len(w.segs) > 1 && w.segs[0].live <= 0 {
+		if err := os.Remove(w.segs[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w.segs = w.segs[1:]
+	}
+	return nil
+}
+
+// write adds a record to the current segment
+func (w *wal) write(typ byte, seq uint64, payload []byte) error {
+	s := w.segs[len(w.segs)-1]
+	if s.size > 0 && s.size+int64(recordHeader+len(payload)) > w.maxSize {
+		if err := w.roll(); err != nil {
+			return err
+		}
+		s = w.segs[len(w.segs)-1]
+	}
+
+	rec := make([]byte, recordHeader+len(payload))
+	rec[0] = typ
+	binary.BigEndian.PutUint64(rec[1:9], seq)
+	binary.BigEndian.PutUint32(rec[9:13], uint32(len(payload)))
+	copy(rec[recordHeader:], payload)
+	sum := crc32.ChecksumIEEE(rec[:13])
+	binary.BigEndian.PutUint32(rec[13:17], crc32.Update(sum, crc32.IEEETable, payload))
+
+	n, err := w.f.Write(rec)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if w.sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// append writes an item and returns its seq
+func (w *wal) append(payload []byte) (uint64, error) {
+	seq := w.next
+	if err := w.write(recordItem, seq, payload); err != nil {
+		return 0, err
+	}
+	w.next++
+	s := w.segs[len(w.segs)-1]
+	s.live++
+	w.owner[seq] = s
+	return seq, nil
+}
+
+// ack writes an ack for the item seq and removes the segments that are done
+func (w *wal) ack(seq uint64) error {
+	s, ok := w.owner[seq]
+	if !ok {
+		return nil
+	}
+	if err := w.write(recordAck, seq, nil); err != nil {
+		return err
+	}
+
+	s.live--
+	delete(w.owner, seq)
+	return w.trim()
+}
+
+func (w *wal) close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,251 @@
+package pipelines
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// WATCHDOGCHANSIZE is the buffer of the Watchdog event channel, events are dropped when it is full
+const WATCHDOGCHANSIZE = 10
+
+// StallEvent is a stage that has had items to move but has not moved any for a while
+type StallEvent struct {
+	// Stage is the name of the stuck stage, Stats is its snapshot when we saw it
+	Stage string
+	Stats Stats
+
+	// Holder is the stage downstream that is not taking our items, following any
+	// stages that are themselves stuck sending.  It is empty when the stage is not
+	// blocked sending or its output is read by something we can't see
+	Holder      string
+	HolderStats *Stats
+
+	// For is how long the stage has gone without taking or passing on an item
+	For  time.Duration
+	Time time.Time
+}
+
+// Watchdog walks the topology of the pipelines it watches and reports stages that
+// have items waiting, held, or in hand but have not taken or passed on an item
+// for longer than the stall time.  Each stall is reported once, a stage that
+// recovers and stalls again is reported again.
+//
+// OnStall, when set, is called from the watchdog goroutine for each stall and the
+// event is also sent to the output channel if there is room.
+//
+// The stages stamp LastIn and LastOut with their own Clock, give the watchdog the
+// same Clock as the stages it watches.
+type Watchdog struct {
+	OnStall func(StallEvent)
+
+	// Interval is how often we check, defaults to a quarter of the stall time
+	Interval time.Duration
+
+	// Clock is used for Interval and the stall time, nil is RealClock
+	Clock Clock
+
+	ctx context.Context
+	can context.CancelFunc
+
+	outchan chan StallEvent
+
+	stall time.Duration
+	tails []any
+
+	// busy is when we first saw a stage with work, stalled is the stages we have reported
+	busy    map[any]time.Time
+	stalled map[any]bool
+
+	wg   *sync.WaitGroup
+	done chan struct{}
+}
+
+// OutChan
+func (w Watchdog) OutChan() <-chan StallEvent {
+	return w.outchan
+}
+
+// PipelineChan returns a R/W channel that is used for pipelining
+func (w Watchdog) PipelineChan() chan StallEvent {
+	return w.outchan
+}
+
+// Close stops the watchdog, the pipelines we watch are left alone
+func (w *Watchdog) Close() {
+	// Cancel our context
+	w.can()
+
+	// Wait for us to be done
+	w.wg.Wait()
+}
+
+// Done returns a channel that is closed once we have stopped
+func (w Watchdog) Done() <-chan struct{} {
+	return w.done
+}
+
+// check walks the stages and returns the new stalls
+func (w *Watchdog) check(now time.Time) []StallEvent {
+	t, stages := walk(nil, w.tails...)
+
+	down := make(map[int][]int)
+	for _, e := range t.Edges {
+		down[e.From] = append(down[e.From], e.To)
+	}
+
+	var events []StallEvent
+	seen := make(map[any]bool, len(stages))
+	for i, n := range t.Nodes {
+		s := stages[i]
+		st := n.Stats
+		if st == nil || !reflect.TypeOf(s).Comparable() {
+			continue
+		}
+		seen[s] = true
+
+		if st.State == STATESTOPPED || (st.Waiting == 0 && st.Held == 0 && st.State == STATERECEIVING) {
+			delete(w.busy, s)
+			delete(w.stalled, s)
+			continue
+		}
+
+		// The last time we saw it move, either an item or going from idle to busy
+		last, ok := w.busy[s]
+		if !ok {
+			last = now
+			w.busy[s] = now
+		}
+		for _, tm := range []time.Time{st.LastIn, st.LastOut} {
+			if tm.After(last) {
+				last = tm
+			}
+		}
+		if now.Sub(last) < w.stall {
+			delete(w.stalled, s)
+			continue
+		}
+		if w.stalled[s] {
+			continue
+		}
+		w.stalled[s] = true
+
+		e := StallEvent{Stage: n.Name, Stats: *st, For: now.Sub(last), Time: now}
+		if st.State == STATESENDING {
+			if h := holder(t, down, i); h >= 0 {
+				e.Holder = t.Nodes[h].Name
+				e.HolderStats = t.Nodes[h].Stats
+			}
+		}
+		events = append(events, e)
+	}
+
+	// Forget stages that are gone
+	for s := range w.busy {
+		if !seen[s] {
+			delete(w.busy, s)
+			delete(w.stalled, s)
+		}
+	}
+
+	return events
+}
+
+// holder follows the stages downstream of i while they are stuck sending and returns
+// the first one that is not, the last one we can see, or -1 if there is none
+func holder(t Topology, down map[int][]int, i int) int {
+	h := -1
+	visited := map[int]bool{i: true}
+	for {
+		next := -1
+		for _, j := range down[i] {
+			if visited[j] {
+				continue
+			}
+			// Follow a branch that is stuck if there is one, a tee is held up by its slowest
+			if next < 0 || sending(t.Nodes[j]) {
+				next = j
+			}
+		}
+		if next < 0 {
+			return h
+		}
+		visited[next] = true
+		h = next
+
+		if !sending(t.Nodes[next]) {
+			return h
+		}
+		i = next
+	}
+}
+
+func sending(n TopologyNode) bool {
+	return n.Stats != nil && n.Stats.State == STATESENDING
+}
+
+// mainloop checks the stages each interval
+// exit when our context is closed
+func (w *Watchdog) mainloop() {
+	defer close(w.done)
+	defer w.wg.Done()
+	defer close(w.outchan)
+
+	ticker := w.Clock.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			for _, e := range w.check(now) {
+				if w.OnStall != nil {
+					w.OnStall(e)
+				}
+				// Never block, a watchdog that stalls is no use
+				select {
+				case w.outchan <- e:
+				default:
+				}
+			}
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// New watches the pipelines ending at tails, see WalkTopology.  A stage is stalled
+// when it has not moved an item for the stall time
+func (w Watchdog) New(stall time.Duration, tails ...any) *Watchdog {
+	return w.NewWithContext(context.Background(), stall, tails...)
+}
+
+func (w Watchdog) NewWithContext(ctx context.Context, stall time.Duration, tails ...any) *Watchdog {
+	con, cancel := context.WithCancel(ctx)
+
+	r := Watchdog{
+		OnStall:  w.OnStall,
+		Interval: w.Interval,
+		Clock:    orRealClock(w.Clock),
+		ctx:      con,
+		can:      cancel,
+		outchan:  make(chan StallEvent, WATCHDOGCHANSIZE),
+		stall:    stall,
+		tails:    tails,
+		busy:     make(map[any]time.Time),
+		stalled:  make(map[any]bool),
+		wg:       new(sync.WaitGroup),
+		done:     make(chan struct{})}
+
+	if r.Interval <= 0 {
+		r.Interval = stall / 4
+	}
+	if r.Interval <= 0 {
+		r.Interval = time.Millisecond
+	}
+
+	r.wg.Add(1)
+	go r.mainloop()
+
+	return &r
+}
@@ -0,0 +1,112 @@
+package pipelines_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sterlingdevils/pipelines"
+)
+
+func ExampleWatchdog() {
+	in := make(chan int, 2)
+	parse := pipelines.ConverterPipe[int, int]{}.NewWithChannel(in, func(i int) (int, error) { return i, nil })
+	parse.SetMetrics("parse", nil)
+
+	// slow takes the first item and never finishes it, so parse is stuck sending the second
+	release := make(chan struct{})
+	slow := pipelines.ConverterPipe[int, int]{}.NewWithPipeline(parse, func(i int) (int, error) {
+		<-release
+		return i, nil
+	})
+	slow.SetMetrics("slow", nil)
+
+	in <- 1
+	in <- 2
+	for parse.Stats().State != pipelines.STATESENDING {
+		time.Sleep(time.Millisecond)
+	}
+
+	wd := pipelines.Watchdog{Interval: 10 * time.Millisecond}.New(50*time.Millisecond, slow)
+	for i := 0; i < 2; i++ {
+		e := <-wd.OutChan()
+		fmt.Printf("%v %v held by %q\n", e.Stage, e.Stats.State, e.Holder)
+	}
+
+	wd.Close()
+	close(release)
+	slow.Close()
+	// Output:
+	// parse sending held by "slow"
+	// slow working held by ""
+}
+
+func ExampleWatchdog_clock() {
+	clock := pipelines.NewFakeClock(time.Unix(0, 0))
+
+	// Nothing reads the buffer, so it is stuck sending its first item
+	buffer, _ := pipelines.BufferPipe[int]{Clock: clock}.New(1)
+	buffer.SetMetrics("buffer", nil)
+	buffer.InChan() <- 1
+	buffer.InChan() <- 2
+	for buffer.Stats().State != pipelines.STATESENDING {
+		time.Sleep(time.Millisecond)
+	}
+
+	wd := pipelines.Watchdog{Clock: clock, Interval: time.Second}.New(10*time.Second, buffer)
+	clock.BlockUntil(1)
+
+	var e pipelines.StallEvent
+wait:
+	for {
+		clock.Advance(time.Second)
+		select {
+		case e = <-wd.OutChan():
+			break wait
+		case <-time.After(time.Millisecond):
+		}
+	}
+	fmt.Println(e.Stage, e.Stats.State, e.For >= 10*time.Second)
+
+	wd.Close()
+	buffer.Close()
+	// Output:
+	// buffer sending true
+}
+
+// Stages that have passed on everything they took are idle, not stalled, even when
+// they keep state such as the keys they have seen
+func ExampleWatchdog_idle() {
+	batch, _ := pipelines.BatchPipe[int]{}.New(2, 0, 0)
+	batch.SetMetrics("batch", nil)
+	container := pipelines.ContainerPipe[int, node2]{}.New()
+	container.SetMetrics("container", nil)
+	once := pipelines.OnlyOncePipe[int]{}.New(time.Hour, time.Hour)
+	once.SetMetrics("once", nil)
+
+	batch.InChan() <- 1
+	batch.InChan() <- 2
+	fmt.Println(<-batch.OutChan())
+	container.InChan() <- node2{key: 1}
+	fmt.Println((<-container.OutChan()).Key())
+	once.InChan() <- 1
+	fmt.Println(<-once.OutChan())
+	once.InChan() <- 1
+
+	wd := pipelines.Watchdog{Interval: 10 * time.Millisecond}.New(50*time.Millisecond, batch, container, once)
+	select {
+	case e := <-wd.OutChan():
+		fmt.Println("stalled", e.Stage)
+	case <-time.After(200 * time.Millisecond):
+		fmt.Println("no stalls")
+	}
+
+	wd.Close()
+	batch.Close()
+	container.Close()
+	once.Close()
+	// Output:
+	// [1 2]
+	// 1
+	// 1
+	// no stalls
+}